@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package apply
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/spf13/cobra"
+)
+
+func Apply(fpath string, dryRun bool, prune bool, yes bool, jobs int) error {
+	m, err := LoadManifest(fpath)
+	if err != nil {
+		return err
+	}
+
+	p, err := NewPlan(m, prune, jobs)
+	if err != nil {
+		return err
+	}
+
+	if p.Empty() {
+		fmt.Println("Nothing to do, live state matches the manifest")
+		return nil
+	}
+
+	p.Print()
+	if dryRun {
+		fmt.Println("Dry run, nothing has been changed")
+		return nil
+	}
+
+	if !yes && !efsutil.AskForConfirmation("Apply the plan?") {
+		return nil
+	}
+
+	err = p.Run()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Manifest applied")
+	return nil
+}
+
+var (
+	applyFile   string
+	applyDryRun bool
+	applyPrune  bool
+	applyYes    bool
+	applyJobs   int
+
+	ApplyCmd = &cobra.Command{
+		Use:   "apply -f <manifest>",
+		Short: "reconcile clusters, tenants, buckets, users and services with a manifest",
+		Long: `compare a YAML or JSON manifest of clusters, tenants, buckets with their
+attributes, users and services with their X- config and served paths with
+the live state, print the plan and apply it. Objects missing from the
+manifest are only deleted with --prune. Applying the same manifest twice
+is a no-op.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := Apply(applyFile, applyDryRun, applyPrune, applyYes, applyJobs)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	ApplyCmd.Flags().StringVarP(&applyFile, "file", "f", "", "Manifest file, - for standard input")
+	ApplyCmd.Flags().BoolVarP(&applyDryRun, "dry-run", "", false, "Print the plan without applying it")
+	ApplyCmd.Flags().BoolVarP(&applyPrune, "prune", "", false, "Delete clusters, tenants, buckets, users, services and served paths missing from the manifest")
+	ApplyCmd.Flags().BoolVarP(&applyYes, "yes", "y", false, "Apply without asking for confirmation")
+	ApplyCmd.Flags().IntVarP(&applyJobs, "jobs", "j", 16, "Number of parallel deletes when pruning")
+	ApplyCmd.MarkFlagRequired("file")
+}
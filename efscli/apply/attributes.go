@@ -0,0 +1,219 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package apply
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sabbot/module/efscli/efsutil"
+)
+
+// attributes of each level, as accepted by the create commands
+var (
+	clusterAttrs = []string{
+		"replication-count",
+		"select-policy",
+		"ec-data-mode",
+		"ec-trigger-policy-timeout",
+		"options",
+	}
+
+	tenantAttrs = []string{
+		"replication-count",
+		"number-of-versions",
+		"sync-put",
+		"ec-data-mode",
+		"ec-trigger-policy-timeout",
+		"encryption-enabled",
+		"select-policy",
+		"options",
+	}
+
+	bucketAttrs = []string{
+		"chunk-size",
+		"number-of-versions",
+		"replication-count",
+		"sync-put",
+		"ec-data-mode",
+		"ec-trigger-policy-timeout",
+		"encryption-enabled",
+		"select-policy",
+		"quota",
+		"quota-count",
+		"file-object-transparency",
+		"options",
+	}
+)
+
+// attrKeys are the metadata keys attribute values are kept in. Attributes
+// without one, e.g. file-object-transparency, are only set on creation.
+var attrKeys = map[string]string{
+	"chunk-size":                "ccow-chunkmap-chunk-size",
+	"number-of-versions":        "ccow-number-of-versions",
+	"replication-count":         "ccow-replication-count",
+	"sync-put":                  "ccow-sync-put",
+	"ec-data-mode":              "ccow-ec-data-mode",
+	"ec-trigger-policy-timeout": "ccow-ec-trigger-policy",
+	"encryption-enabled":        "ccow-hash-type",
+	"select-policy":             "ccow-select-policy",
+	"quota":                     "X-container-meta-quota-bytes",
+	"quota-count":               "X-container-meta-quota-count",
+}
+
+type attrChange struct {
+	name string
+	live string
+	want string
+}
+
+// attrLive returns the attribute value of metadata in the form of the
+// create flags
+func attrLive(name string, md map[string]string) string {
+	v := md[attrKeys[name]]
+	switch name {
+	case "ec-data-mode":
+		if md["ccow-ec-enabled"] != "1" {
+			return ""
+		}
+		var m efsutil.ECMode
+		code, _ := strconv.Atoi(v)
+		if m.Decode(code) == nil {
+			return m.String()
+		}
+	case "ec-trigger-policy-timeout":
+		t, err := strconv.ParseUint(v, 10, 64)
+		if err == nil {
+			return strconv.FormatUint(t>>4, 10)
+		}
+	case "encryption-enabled":
+		if v == "129" {
+			return "1"
+		}
+		return ""
+	case "select-policy":
+		if v == "2" {
+			return "capacity"
+		} else if v == "4" {
+			return "latency"
+		}
+	}
+	return v
+}
+
+// attrWant normalizes a flag value the way it is going to be stored
+func attrWant(name string, v string) string {
+	switch name {
+	case "chunk-size", "volsize", "blocksize":
+		i, err := efsutil.GetBytes(v)
+		if err == nil {
+			return strconv.FormatInt(i, 10)
+		}
+	case "ec-trigger-policy-timeout":
+		if _, err := strconv.ParseUint(v, 10, 64); err == nil {
+			return v
+		}
+		t, err := time.ParseDuration(v)
+		if err == nil {
+			return strconv.FormatInt(int64(t/time.Second), 10)
+		}
+	}
+	return v
+}
+
+// wantAttributes merges the profile into the attributes of the manifest,
+// the latter take precedence. Profile attributes the level does not have
+// are left out.
+func wantAttributes(names []string, profile string, attrs map[string]Value) (map[string]string, error) {
+	res := make(map[string]string)
+	if profile != "" {
+		p, err := efsutil.LoadProfile(profile)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range names {
+			if v, ok := p[n]; ok {
+				res[n] = v
+			}
+		}
+	}
+	for k, v := range attrs {
+		res[k] = string(v)
+	}
+	return res, nil
+}
+
+// attrChanges compares wanted attributes with the metadata and returns the
+// differences along with the flag values which reconcile them
+func attrChanges(want map[string]string, md map[string]string) ([]attrChange, map[string]string) {
+	var res []attrChange
+	update := make(map[string]string)
+
+	for name, v := range want {
+		if name == "options" {
+			var opts []string
+			for _, e := range strings.Split(v, ",") {
+				s := strings.SplitN(e, "=", 2)
+				if len(s) < 2 {
+					continue
+				}
+				live := md["X-"+s[0]]
+				if live != attrWant(s[0], s[1]) {
+					res = append(res, attrChange{"X-" + s[0], live, s[1]})
+					opts = append(opts, e)
+				}
+			}
+			if len(opts) > 0 {
+				update[name] = strings.Join(opts, ",")
+			}
+			continue
+		}
+
+		if _, ok := attrKeys[name]; !ok {
+			continue
+		}
+		live := attrLive(name, md)
+		if live != attrWant(name, v) {
+			res = append(res, attrChange{name, live, v})
+			update[name] = v
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].name < res[j].name })
+	return res, update
+}
+
+func formatChanges(changes []attrChange) string {
+	var res []string
+	for _, c := range changes {
+		live := c.live
+		if live == "" {
+			live = "-"
+		}
+		res = append(res, c.name+" "+live+" -> "+c.want)
+	}
+	return strings.Join(res, ", ")
+}
@@ -0,0 +1,307 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package apply
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/sabbot/module/efscli/validate"
+)
+
+// Manifest is the desired layout of namespaces and services. Clusters,
+// tenants, buckets, users and services which exist but are not listed are
+// only removed with --prune. Attributes use the names of the create flags.
+type Manifest struct {
+	Clusters []Cluster `json:"clusters"`
+	Services []Service `json:"services"`
+}
+
+type Cluster struct {
+	Name       string           `json:"name"`
+	Attributes map[string]Value `json:"attributes"`
+	Tenants    []Tenant         `json:"tenants"`
+}
+
+type Tenant struct {
+	Name       string           `json:"name"`
+	Profile    string           `json:"profile"`
+	Attributes map[string]Value `json:"attributes"`
+	Buckets    []Bucket         `json:"buckets"`
+	Users      []User           `json:"users"`
+}
+
+type Bucket struct {
+	Name       string           `json:"name"`
+	Profile    string           `json:"profile"`
+	Attributes map[string]Value `json:"attributes"`
+}
+
+type User struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	Admin    Value  `json:"admin"`
+	Authkey  string `json:"authkey"`
+	Secret   string `json:"secret"`
+}
+
+type Service struct {
+	Name   string           `json:"name"`
+	Type   string           `json:"type"`
+	Config map[string]Value `json:"config"`
+	Serve  []Serve          `json:"serve"`
+}
+
+// Serve is a path served by a service, options are those of iSCSI LUNs
+type Serve struct {
+	Path    string `json:"path"`
+	Options string `json:"options"`
+}
+
+// Value is a scalar of the manifest, JSON numbers and booleans are taken
+// as they are written
+type Value string
+
+func (v *Value) UnmarshalJSON(b []byte) error {
+	var x interface{}
+	err := json.Unmarshal(b, &x)
+	if err != nil {
+		return err
+	}
+	switch t := x.(type) {
+	case string:
+		*v = Value(t)
+	case float64, bool:
+		*v = Value(strings.TrimSpace(string(b)))
+	case nil:
+		*v = ""
+	default:
+		return fmt.Errorf("expecting a scalar, got %s", b)
+	}
+	return nil
+}
+
+func (v Value) Bool() bool {
+	switch strings.ToLower(string(v)) {
+	case "true", "yes", "1", "admin":
+		return true
+	}
+	return false
+}
+
+// UnmarshalJSON accepts a bare bucket name as well
+func (b *Bucket) UnmarshalJSON(data []byte) error {
+	var name string
+	if json.Unmarshal(data, &name) == nil {
+		*b = Bucket{Name: name}
+		return nil
+	}
+	type bucket Bucket
+	return json.Unmarshal(data, (*bucket)(b))
+}
+
+// UnmarshalJSON accepts a bare path as well
+func (s *Serve) UnmarshalJSON(data []byte) error {
+	var path string
+	if json.Unmarshal(data, &path) == nil {
+		*s = Serve{Path: path}
+		return nil
+	}
+	type serve Serve
+	return json.Unmarshal(data, (*serve)(s))
+}
+
+func values(m map[string]Value) map[string]string {
+	res := make(map[string]string)
+	for k, v := range m {
+		res[k] = string(v)
+	}
+	return res
+}
+
+func formatValues(m map[string]string) string {
+	var res []string
+	for k, v := range m {
+		res = append(res, k+"="+v)
+	}
+	sort.Strings(res)
+	return strings.Join(res, ", ")
+}
+
+// LoadManifest reads a YAML or JSON manifest, "-" reads standard input
+func LoadManifest(fpath string) (*Manifest, error) {
+	var data []byte
+	var err error
+	if fpath == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(fpath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	j, err := efsutil.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("Manifest %s: %v", fpath, err)
+	}
+
+	var m Manifest
+	dec := json.NewDecoder(bytes.NewReader(j))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&m)
+	if err != nil {
+		return nil, fmt.Errorf("Manifest %s: %v", fpath, err)
+	}
+
+	err = m.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("Manifest %s: %v", fpath, err)
+	}
+	return &m, nil
+}
+
+func checkName(kind string, name string, seen map[string]bool) error {
+	r, _ := regexp.Compile("^[^/ ]+$")
+	if !r.MatchString(name) {
+		return fmt.Errorf("Invalid %s name '%s'", kind, name)
+	}
+	if seen[name] {
+		return fmt.Errorf("Duplicate %s %s", kind, name)
+	}
+	seen[name] = true
+	return nil
+}
+
+func checkAttributes(path string, names []string, attrs map[string]Value) error {
+	flags, err := efsutil.NewFlags(names, values(attrs))
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	err = validate.Flags(flags)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// servePathDepth is the number of path components served by a service type
+var servePathDepth = map[string]int{
+	"nfs":   3,
+	"isgw":  3,
+	"s3":    2,
+	"s3x":   2,
+	"swift": 2,
+	"iscsi": 4,
+}
+
+func (m *Manifest) Validate() error {
+	clusters := make(map[string]bool)
+	for _, c := range m.Clusters {
+		err := checkName("cluster", c.Name, clusters)
+		if err != nil {
+			return err
+		}
+		err = checkAttributes(c.Name, clusterAttrs, c.Attributes)
+		if err != nil {
+			return err
+		}
+
+		tenants := make(map[string]bool)
+		for _, t := range c.Tenants {
+			tpath := c.Name + "/" + t.Name
+			err = checkName("tenant", t.Name, tenants)
+			if err != nil {
+				return err
+			}
+			err = checkAttributes(tpath, tenantAttrs, t.Attributes)
+			if err != nil {
+				return err
+			}
+
+			buckets := make(map[string]bool)
+			for _, b := range t.Buckets {
+				err = checkName("bucket", b.Name, buckets)
+				if err != nil {
+					return err
+				}
+				err = checkAttributes(tpath+"/"+b.Name, bucketAttrs, b.Attributes)
+				if err != nil {
+					return err
+				}
+			}
+
+			users := make(map[string]bool)
+			for _, u := range t.Users {
+				err = checkName("user", u.Name, users)
+				if err != nil {
+					return err
+				}
+				if u.Password == "" {
+					return fmt.Errorf("User %s of %s has no password", u.Name, tpath)
+				}
+			}
+		}
+	}
+
+	services := make(map[string]bool)
+	for _, s := range m.Services {
+		err := checkName("service", s.Name, services)
+		if err != nil {
+			return err
+		}
+		if s.Type != "" {
+			if _, ok := servePathDepth[s.Type]; !ok {
+				return fmt.Errorf("Service %s has invalid type %s", s.Name, s.Type)
+			}
+		}
+		for k := range s.Config {
+			if !strings.HasPrefix(k, "X-") {
+				return fmt.Errorf("Service %s config key %s does not start with X-", s.Name, k)
+			}
+		}
+		for _, e := range s.Serve {
+			if s.Type != "" && len(strings.Split(e.Path, "/")) != servePathDepth[s.Type] {
+				return fmt.Errorf("Service %s of type %s cannot serve %s", s.Name, s.Type, e.Path)
+			}
+			if e.Options != "" {
+				if s.Type != "iscsi" {
+					return fmt.Errorf("Service %s path %s: options are only supported by iscsi", s.Name, e.Path)
+				}
+				err = validate.ServiceIscsiOpts(e.Path, e.Options)
+				if err != nil {
+					return fmt.Errorf("Service %s path %s: %v", s.Name, e.Path, err)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,574 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package apply
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sabbot/module/efscli/bucket"
+	"github.com/sabbot/module/efscli/cluster"
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/sabbot/module/efscli/service"
+	"github.com/sabbot/module/efscli/tenant"
+	"github.com/sabbot/module/efscli/user"
+)
+
+const (
+	opCreate = "+"
+	opChange = "~"
+	opDelete = "-"
+)
+
+type action struct {
+	op     string
+	kind   string
+	name   string
+	detail string
+	run    func() error
+}
+
+// Plan is the list of actions which reconcile the live state with the
+// manifest. Creates and changes run top down, deletes bottom up after them.
+// Namespace prunes run last, once services no longer serve from them.
+type Plan struct {
+	actions  []action
+	deletes  []action
+	prunes   []action
+	unserved map[efsutil.ServiceEntry]bool
+	jobs     int
+	prune    bool
+}
+
+func (p *Plan) add(op string, kind string, name string, detail string, run func() error) {
+	a := action{op, kind, name, detail, run}
+	if op == opDelete {
+		p.deletes = append(p.deletes, a)
+	} else {
+		p.actions = append(p.actions, a)
+	}
+}
+
+// unserve removes a service entry and remembers it, so that a later
+// namespace prune does not unserve it again
+func (p *Plan) unserve(e efsutil.ServiceEntry) error {
+	err := service.UnserveEntry(e)
+	if err != nil {
+		return err
+	}
+	p.unserved[e] = true
+	return nil
+}
+
+func contains(list []string, name string) bool {
+	for _, n := range list {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// teardownDetail summarizes what a recursive delete of the namespace removes
+func teardownDetail(t *bucket.Teardown) string {
+	objects := 0
+	for _, o := range t.Objects {
+		objects += len(o)
+	}
+	var res []string
+	if len(t.Tenants) > 0 {
+		res = append(res, fmt.Sprintf("%d tenant(s)", len(t.Tenants)))
+	}
+	res = append(res, fmt.Sprintf("%d bucket(s)", len(t.Buckets)))
+	res = append(res, fmt.Sprintf("%d object(s)", objects))
+	if len(t.Entries) > 0 {
+		res = append(res, fmt.Sprintf("%d service entries", len(t.Entries)))
+	}
+	return strings.Join(res, ", ")
+}
+
+func (p *Plan) pruneNamespace(kind string, ns string) error {
+	t, err := bucket.NewTeardown(ns)
+	if err != nil {
+		return err
+	}
+
+	run := func() error {
+		var entries []efsutil.ServiceEntry
+		for _, e := range t.Entries {
+			if !p.unserved[e] {
+				entries = append(entries, e)
+			}
+		}
+		t.Entries = entries
+
+		err := t.Run(p.jobs)
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case "tenant":
+			return tenant.TenantDelete(ns)
+		case "cluster":
+			for _, tpath := range t.Tenants {
+				err = tenant.TenantDelete(tpath)
+				if err != nil {
+					return fmt.Errorf("Tenant %s not deleted: %v", tpath, err)
+				}
+			}
+			return cluster.ClusterDelete(ns)
+		}
+		return nil
+	}
+	p.prunes = append(p.prunes, action{opDelete, kind, ns, teardownDetail(t), run})
+	return nil
+}
+
+func (p *Plan) bucket(tpath string, b Bucket, exists bool) error {
+	bpath := tpath + "/" + b.Name
+
+	want, err := wantAttributes(bucketAttrs, b.Profile, b.Attributes)
+	if err != nil {
+		return fmt.Errorf("Bucket %s: %v", bpath, err)
+	}
+
+	if !exists {
+		p.add(opCreate, "bucket", bpath, formatValues(want), func() error {
+			flags, err := efsutil.NewFlags(bucketAttrs, want)
+			if err != nil {
+				return err
+			}
+			return bucket.BucketCreate(bpath, flags)
+		})
+		return nil
+	}
+
+	s := strings.Split(bpath, "/")
+	md, err := efsutil.GetMDPat(s[0], s[1], s[2], "", "")
+	if err != nil {
+		return fmt.Errorf("Bucket %s: %v", bpath, err)
+	}
+	custom, err := efsutil.GetBucketCustomMD(s[0], s[1], s[2])
+	if err != nil {
+		return fmt.Errorf("Bucket %s: %v", bpath, err)
+	}
+	for k, v := range custom {
+		md[k] = v
+	}
+	changes, update := attrChanges(want, md)
+	if len(changes) > 0 {
+		p.add(opChange, "bucket", bpath, formatChanges(changes), func() error {
+			flags, err := efsutil.NewFlags(bucketAttrs, update)
+			if err != nil {
+				return err
+			}
+			return bucket.BucketUpdate(bpath, flags)
+		})
+	}
+	return nil
+}
+
+func (p *Plan) users(tpath string, users []User, exists bool) error {
+	var live []*efsutil.User
+	if exists {
+		var err error
+		s := strings.Split(tpath, "/")
+		live, err = efsutil.GetUsers(s[0], s[1])
+		if err != nil {
+			return fmt.Errorf("Tenant %s users: %v", tpath, err)
+		}
+	}
+
+	var names []string
+	for _, u := range live {
+		names = append(names, u.Username)
+	}
+
+	for _, u := range users {
+		if contains(names, u.Name) {
+			continue
+		}
+		u := u
+		detail := ""
+		opt := ""
+		if u.Admin.Bool() {
+			detail = "admin"
+			opt = "admin"
+		}
+		p.add(opCreate, "user", tpath+"/"+u.Name, detail, func() error {
+			return user.UserCreate(tpath, u.Name, u.Password, opt, u.Authkey, u.Secret)
+		})
+	}
+
+	if !p.prune {
+		return nil
+	}
+	for _, u := range live {
+		found := false
+		for _, w := range users {
+			if w.Name == u.Username {
+				found = true
+				break
+			}
+		}
+		if !found {
+			u := u
+			p.add(opDelete, "user", tpath+"/"+u.Username, "", func() error {
+				s := strings.Split(tpath, "/")
+				return efsutil.DeleteUser(s[0], s[1], u)
+			})
+		}
+	}
+	return nil
+}
+
+func (p *Plan) tenant(cl string, t Tenant, exists bool) error {
+	tpath := cl + "/" + t.Name
+
+	want, err := wantAttributes(tenantAttrs, t.Profile, t.Attributes)
+	if err != nil {
+		return fmt.Errorf("Tenant %s: %v", tpath, err)
+	}
+
+	var liveBuckets []string
+	if !exists {
+		p.add(opCreate, "tenant", tpath, formatValues(want), func() error {
+			flags, err := efsutil.NewFlags(tenantAttrs, want)
+			if err != nil {
+				return err
+			}
+			return tenant.TenantCreate(tpath, flags)
+		})
+	} else {
+		md, err := efsutil.GetMDPat(cl, t.Name, "", "", "")
+		if err != nil {
+			return fmt.Errorf("Tenant %s: %v", tpath, err)
+		}
+		changes, update := attrChanges(want, md)
+		if len(changes) > 0 {
+			p.add(opChange, "tenant", tpath, formatChanges(changes), func() error {
+				flags, err := efsutil.NewFlags(tenantAttrs, update)
+				if err != nil {
+					return err
+				}
+				return tenant.TenantUpdate(tpath, flags)
+			})
+		}
+
+		liveBuckets, err = efsutil.GetBuckets(cl, t.Name)
+		if err != nil {
+			return fmt.Errorf("Tenant %s buckets: %v", tpath, err)
+		}
+	}
+
+	var names []string
+	for _, b := range t.Buckets {
+		names = append(names, b.Name)
+		err = p.bucket(tpath, b, contains(liveBuckets, b.Name))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = p.users(tpath, t.Users, exists)
+	if err != nil {
+		return err
+	}
+
+	if p.prune {
+		for _, bk := range liveBuckets {
+			if !contains(names, bk) {
+				err = p.pruneNamespace("bucket", tpath+"/"+bk)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Plan) cluster(c Cluster, exists bool) error {
+	want := values(c.Attributes)
+
+	var liveTenants []string
+	if !exists {
+		p.add(opCreate, "cluster", c.Name, formatValues(want), func() error {
+			flags, err := efsutil.NewFlags(clusterAttrs, want)
+			if err != nil {
+				return err
+			}
+			return cluster.ClusterCreate(c.Name, flags)
+		})
+	} else {
+		md, err := efsutil.GetMDPat(c.Name, "", "", "", "")
+		if err != nil {
+			return fmt.Errorf("Cluster %s: %v", c.Name, err)
+		}
+		changes, update := attrChanges(want, md)
+		if len(changes) > 0 {
+			p.add(opChange, "cluster", c.Name, formatChanges(changes), func() error {
+				flags, err := efsutil.NewFlags(clusterAttrs, update)
+				if err != nil {
+					return err
+				}
+				if len(efsutil.NewDataOnlyAttributes(flags)) > 0 {
+					err = efsutil.UpdateDefaultAttributes(c.Name, "", "", "", flags)
+					if err != nil {
+						return err
+					}
+				}
+				if efsutil.HasCustomAttributes(flags) {
+					return efsutil.ModifyCustomAttributes(c.Name, "", "", "", flags)
+				}
+				return nil
+			})
+		}
+
+		liveTenants, err = efsutil.GetTenants(c.Name)
+		if err != nil {
+			return fmt.Errorf("Cluster %s tenants: %v", c.Name, err)
+		}
+	}
+
+	var names []string
+	for _, t := range c.Tenants {
+		names = append(names, t.Name)
+		err := p.tenant(c.Name, t, contains(liveTenants, t.Name))
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.prune {
+		for _, tn := range liveTenants {
+			if !contains(names, tn) {
+				err := p.pruneNamespace("tenant", c.Name+"/"+tn)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Plan) service(s Service, exists bool, entries []efsutil.ServiceEntry) error {
+	want := values(s.Config)
+
+	if !exists {
+		if s.Type == "" {
+			return fmt.Errorf("Service %s does not exist and has no type", s.Name)
+		}
+		p.add(opCreate, "service", s.Name, strings.TrimSpace("type="+s.Type+" "+formatValues(want)), func() error {
+			err := service.ServiceCreate(s.Type, s.Name)
+			if err != nil || len(want) == 0 {
+				return err
+			}
+			return efsutil.UpdateMDMany("", "svcs", s.Name, "", keyValues(want))
+		})
+	} else {
+		md, err := efsutil.GetMDPat("", "svcs", s.Name, "", "X-")
+		if err != nil {
+			return fmt.Errorf("Service %s: %v", s.Name, err)
+		}
+		if s.Type != "" && md["X-Service-Type"] != s.Type {
+			return fmt.Errorf("Service %s is of type %s, manifest says %s", s.Name, md["X-Service-Type"], s.Type)
+		}
+
+		var changes []attrChange
+		update := make(map[string]string)
+		for k, v := range want {
+			if md[k] != v {
+				changes = append(changes, attrChange{k, md[k], v})
+				update[k] = v
+			}
+		}
+		if len(changes) > 0 {
+			sort.Slice(changes, func(i, j int) bool { return changes[i].name < changes[j].name })
+			p.add(opChange, "service", s.Name, formatChanges(changes), func() error {
+				return efsutil.UpdateMDMany("", "svcs", s.Name, "", keyValues(update))
+			})
+		}
+	}
+
+	var served []string
+	for _, e := range entries {
+		served = append(served, efsutil.ServiceObjectPath(e.Type, e.Entry))
+	}
+
+	var paths []string
+	for _, e := range s.Serve {
+		paths = append(paths, e.Path)
+		if contains(served, e.Path) {
+			continue
+		}
+		args := []string{s.Name, e.Path}
+		if e.Options != "" {
+			args = append(args, e.Options)
+		}
+		p.add(opCreate, "serve", s.Name+" "+e.Path, e.Options, func() error {
+			return service.ServiceServe(args)
+		})
+	}
+
+	if p.prune {
+		for _, e := range entries {
+			if contains(paths, efsutil.ServiceObjectPath(e.Type, e.Entry)) {
+				continue
+			}
+			e := e
+			p.add(opDelete, "serve", s.Name+" "+efsutil.ServiceObjectPath(e.Type, e.Entry), "", func() error {
+				return p.unserve(e)
+			})
+		}
+	}
+	return nil
+}
+
+func keyValues(m map[string]string) []efsutil.KeyValue {
+	var res []efsutil.KeyValue
+	for k, v := range m {
+		res = append(res, efsutil.KeyValue{Key: k, Value: v})
+	}
+	return res
+}
+
+// NewPlan compares the manifest with the live state
+func NewPlan(m *Manifest, prune bool, jobs int) (*Plan, error) {
+	p := &Plan{jobs: jobs, prune: prune, unserved: make(map[efsutil.ServiceEntry]bool)}
+
+	liveClusters, err := efsutil.GetClusters()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, c := range m.Clusters {
+		names = append(names, c.Name)
+		err = p.cluster(c, contains(liveClusters, c.Name))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	liveServices, err := efsutil.GetServices()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := efsutil.GetServiceEntries("")
+	if err != nil {
+		return nil, err
+	}
+	byService := make(map[string][]efsutil.ServiceEntry)
+	for _, e := range entries {
+		byService[e.Service] = append(byService[e.Service], e)
+	}
+
+	var svcNames []string
+	for _, s := range m.Services {
+		svcNames = append(svcNames, s.Name)
+		err = p.service(s, contains(liveServices, s.Name), byService[s.Name])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !prune {
+		return p, nil
+	}
+
+	// namespace prunes are queued separately and run after these, entries
+	// unserved here are skipped by their teardown
+	for _, svc := range liveServices {
+		if contains(svcNames, svc) {
+			continue
+		}
+		svc := svc
+		detail := fmt.Sprintf("%d served", len(byService[svc]))
+		p.add(opDelete, "service", svc, detail, func() error {
+			for _, e := range byService[svc] {
+				err := p.unserve(e)
+				if err != nil {
+					return fmt.Errorf("Unserve of %s failed: %v", e.Entry, err)
+				}
+			}
+			return service.ServiceDelete(svc)
+		})
+	}
+	for _, cl := range liveClusters {
+		if !contains(names, cl) {
+			err = p.pruneNamespace("cluster", cl)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return p, nil
+}
+
+// Empty tells whether the live state already matches the manifest
+func (p *Plan) Empty() bool {
+	return len(p.actions) == 0 && len(p.deletes) == 0 && len(p.prunes) == 0
+}
+
+func (p *Plan) all() []action {
+	var res []action
+	res = append(res, p.actions...)
+	res = append(res, p.deletes...)
+	return append(res, p.prunes...)
+}
+
+func (p *Plan) Print() {
+	creates, changes := 0, 0
+	for _, a := range p.all() {
+		switch a.op {
+		case opCreate:
+			creates++
+		case opChange:
+			changes++
+		}
+		if a.detail != "" {
+			fmt.Printf("  %s %-8s %s (%s)\n", a.op, a.kind, a.name, a.detail)
+		} else {
+			fmt.Printf("  %s %-8s %s\n", a.op, a.kind, a.name)
+		}
+	}
+	fmt.Printf("\nPlan: %d to create, %d to change, %d to delete\n", creates, changes, len(p.deletes)+len(p.prunes))
+}
+
+// Run executes the plan and stops at the first failure, the manifest can
+// be applied again to continue
+func (p *Plan) Run() error {
+	all := p.all()
+	for i, a := range all {
+		fmt.Printf("%s %s %s\n", a.op, a.kind, a.name)
+		err := a.run()
+		if err != nil {
+			return fmt.Errorf("%s %s failed: %v (%d of %d action(s) applied)", a.kind, a.name, err, i, len(all))
+		}
+	}
+	return nil
+}
@@ -119,6 +119,7 @@ var (
 		"options",
 	}
 	flags []efsutil.FlagValue
+	createProfile string
 
 	createCmd = &cobra.Command{
 		Use:   "create  <cluster>/<tenant>/<bucket>",
@@ -126,6 +127,13 @@ var (
 		Long:  "create a new bucket",
 		Args:  validate.Bucket,
 		Run: func(cmd *cobra.Command, args []string) {
+			if createProfile != "" {
+				err := efsutil.ApplyProfile(cmd, flagNames, flags, createProfile)
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+			}
 			err := BucketCreate(args[0], flags)
 			if err != nil {
 				fmt.Println(err)
@@ -138,5 +146,6 @@ var (
 func init() {
 	flags = make([]efsutil.FlagValue, len(flagNames))
 	efsutil.ReadAttributes(createCmd, flagNames, flags)
+	createCmd.Flags().StringVarP(&createProfile, "profile", "P", "", "Attribute profile, explicit flags take precedence")
 	BucketCmd.AddCommand(createCmd)
 }
@@ -92,14 +92,38 @@ func BucketDelete(bpath string) error {
 	return nil
 }
 
+// BucketDeleteRecursive removes service entries referencing the bucket,
+// all of its objects and then the bucket itself
+func BucketDeleteRecursive(bpath string, dryRun bool, jobs int) error {
+	t, err := NewTeardown(bpath)
+	if err != nil {
+		return err
+	}
+
+	if !t.Confirm(dryRun) {
+		return nil
+	}
+
+	return t.Run(jobs)
+}
+
 var (
+	deleteRecursive bool
+	deleteDryRun    bool
+	deleteJobs      int
+
 	deleteCmd = &cobra.Command{
 		Use:   "delete <cluster>/<tenant>/<bucket>",
 		Short: "delete an existing bucket",
 		Long:  "delete an existing bucket",
 		Args:  validate.Bucket,
 		Run: func(cmd *cobra.Command, args []string) {
-			err := BucketDelete(args[0])
+			var err error
+			if deleteRecursive || deleteDryRun {
+				err = BucketDeleteRecursive(args[0], deleteDryRun, deleteJobs)
+			} else {
+				err = BucketDelete(args[0])
+			}
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
@@ -109,5 +133,8 @@ var (
 )
 
 func init() {
+	deleteCmd.Flags().BoolVarP(&deleteRecursive, "recursive", "r", false, "Unserve and delete all objects of the bucket first")
+	deleteCmd.Flags().BoolVarP(&deleteDryRun, "dry-run", "", false, "Only show what a recursive delete would remove")
+	deleteCmd.Flags().IntVarP(&deleteJobs, "jobs", "j", 16, "Number of parallel deletes")
 	BucketCmd.AddCommand(deleteCmd)
 }
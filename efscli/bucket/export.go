@@ -0,0 +1,409 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package bucket
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/sabbot/module/efscli/object"
+	"github.com/sabbot/module/efscli/validate"
+	"github.com/spf13/cobra"
+)
+
+// Export archive format, version 1
+//
+// The archive is a tar stream, gzip compressed when its name ends with .gz.
+// The first entry is EXPORT.json holding the exportHeader. Every object
+// then follows as objects/<n>/meta.json holding the exportObject, followed
+// by one payload entry objects/<n>/<file> per revision in the order of
+// exportObject.Revisions. Revisions are sorted by source generation and
+// the last one is the current version of the object. Snapshots are
+// attached to the revision they were taken from, so that import can replay
+// puts and snapshots in the original order.
+const (
+	exportFormat     = "efscli-export"
+	exportVersion    = 1
+	exportHeaderName = "EXPORT.json"
+	exportCurrent    = "data"
+)
+
+type exportSnapview struct {
+	Name     string            `json:"name"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type exportHeader struct {
+	Format    string            `json:"format"`
+	Version   int               `json:"version"`
+	Bucket    string            `json:"bucket"`
+	Created   int64             `json:"created"`
+	Objects   int               `json:"objects"`
+	Metadata  map[string]string `json:"metadata"`
+	Snapviews []exportSnapview  `json:"snapviews,omitempty"`
+}
+
+type exportSnapshot struct {
+	Snapview string            `json:"snapview"`
+	Name     string            `json:"name"`
+	Created  int64             `json:"created"`
+	Tags     map[string]string `json:"tags,omitempty"`
+}
+
+type exportRevision struct {
+	File       string           `json:"file"`
+	Generation uint64           `json:"generation"`
+	Size       uint64           `json:"size"`
+	Snapshots  []exportSnapshot `json:"snapshots,omitempty"`
+}
+
+type exportObject struct {
+	Name      string            `json:"name"`
+	Metadata  map[string]string `json:"metadata"`
+	Revisions []exportRevision  `json:"revisions"`
+}
+
+// snapshotSource is a snapshot of an exported object and the snapview
+// object of the bucket it belongs to
+type snapshotSource struct {
+	snapview string
+	meta     object.SnapshotMeta
+}
+
+// isCustomKey tells user metadata apart from ccow- system attributes
+func isCustomKey(key string) bool {
+	return !strings.HasPrefix(key, "ccow-")
+}
+
+func customMetadata(md map[string]string, skip string) map[string]string {
+	res := make(map[string]string)
+	for k, v := range md {
+		if isCustomKey(k) && (skip == "" || !strings.HasPrefix(k, skip)) {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+func exportWriteFile(tw *tar.Writer, name string, size uint64, r io.Reader) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(size),
+		ModTime: time.Now(),
+	}
+	err := tw.WriteHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, r, int64(size))
+	return err
+}
+
+func exportWriteJSON(tw *tar.Writer, name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return exportWriteFile(tw, name, uint64(len(data)), bytes.NewReader(data))
+}
+
+// exportSnapshots collects snapshots of objects of the bucket from the
+// given snapviews, keyed by object name
+func exportSnapshots(bpath string, snapviews []string) (map[string][]snapshotSource, error) {
+	res := make(map[string][]snapshotSource)
+	for _, sv := range snapviews {
+		snaps, err := object.GetSnapshotsMeta(bpath+"/"+sv, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, ss := range snaps {
+			if !strings.HasPrefix(ss.Source, bpath+"/") {
+				continue
+			}
+			name := strings.TrimPrefix(ss.Source, bpath+"/")
+			res[name] = append(res[name], snapshotSource{snapview: sv, meta: ss})
+		}
+	}
+	return res, nil
+}
+
+// exportRevisions builds the revision list of an object: retained versions,
+// snapshots which do not match any of them and finally the current version
+func exportRevisions(opath string, md map[string]string, versions bool, snaps []snapshotSource) ([]exportRevision, error) {
+	var revs []exportRevision
+
+	if versions {
+		gens, err := object.ObjectVersions(opath)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range gens {
+			revs = append(revs, exportRevision{File: fmt.Sprintf("v%d", g), Generation: g})
+		}
+	}
+
+	var cur exportRevision
+	cur.File = exportCurrent
+	fmt.Sscanf(md["ccow-tx-generation-id"], "%d", &cur.Generation)
+	fmt.Sscanf(md["ccow-logical-size"], "%d", &cur.Size)
+
+	for i, ss := range snaps {
+		es := exportSnapshot{
+			Snapview: ss.snapview,
+			Name:     strings.TrimPrefix(ss.meta.Name, ss.meta.Source+"@"),
+			Created:  ss.meta.Created,
+			Tags:     ss.meta.Tags,
+		}
+
+		if ss.meta.Generation != 0 && ss.meta.Generation == cur.Generation {
+			cur.Snapshots = append(cur.Snapshots, es)
+			continue
+		}
+
+		found := false
+		for j := range revs {
+			if ss.meta.Generation != 0 && revs[j].Generation == ss.meta.Generation {
+				revs[j].Snapshots = append(revs[j].Snapshots, es)
+				found = true
+				break
+			}
+		}
+		if !found {
+			revs = append(revs, exportRevision{File: fmt.Sprintf("s%d", i),
+				Generation: ss.meta.Generation, Snapshots: []exportSnapshot{es}})
+		}
+	}
+
+	sort.SliceStable(revs, func(i, j int) bool {
+		return revs[i].Generation < revs[j].Generation
+	})
+
+	return append(revs, cur), nil
+}
+
+// exportOpenRevision opens the payload of a revision, snapshots which are
+// not backed by a retained version are read from the snapshot itself
+func exportOpenRevision(bpath string, name string, rev exportRevision) (*object.ObjectReader, error) {
+	opath := bpath + "/" + name
+	if rev.File == exportCurrent {
+		return object.OpenObjectReader(opath, 0)
+	}
+	if strings.HasPrefix(rev.File, "v") {
+		return object.OpenObjectReader(opath, rev.Generation)
+	}
+	ss := rev.Snapshots[0]
+	return object.OpenSnapshotReader(bpath+"/"+ss.Snapview, opath+"@"+ss.Name)
+}
+
+func exportObjectEntries(tw *tar.Writer, bpath string, n int, name string, versions bool, snaps []snapshotSource) error {
+	s := strings.Split(bpath, "/")
+	md, err := efsutil.GetMDPat(s[0], s[1], s[2], name, "")
+	if err != nil {
+		return err
+	}
+
+	revs, err := exportRevisions(bpath+"/"+name, md, versions, snaps)
+	if err != nil {
+		return err
+	}
+
+	// payloads are opened up front as the sizes have to be in meta.json
+	readers := make([]*object.ObjectReader, len(revs))
+	defer func() {
+		for _, r := range readers {
+			if r != nil {
+				r.Close()
+			}
+		}
+	}()
+	for i := range revs {
+		readers[i], err = exportOpenRevision(bpath, name, revs[i])
+		if err != nil {
+			return fmt.Errorf("%s revision %s: %v", name, revs[i].File, err)
+		}
+		revs[i].Size = readers[i].Size()
+	}
+
+	eo := exportObject{Name: name, Metadata: md, Revisions: revs}
+	dir := fmt.Sprintf("objects/%d/", n)
+	err = exportWriteJSON(tw, dir+"meta.json", eo)
+	if err != nil {
+		return err
+	}
+
+	for i := range revs {
+		err = exportWriteFile(tw, dir+revs[i].File, revs[i].Size, readers[i])
+		if err != nil {
+			return fmt.Errorf("%s revision %s: %v", name, revs[i].File, err)
+		}
+	}
+	return nil
+}
+
+func exportArchive(tw *tar.Writer, bpath string, hdr exportHeader, names []string,
+	versions bool, snaps map[string][]snapshotSource) error {
+	err := exportWriteJSON(tw, exportHeaderName, hdr)
+	if err != nil {
+		return err
+	}
+
+	for i, name := range names {
+		err = exportObjectEntries(tw, bpath, i, name, versions, snaps[name])
+		if err != nil {
+			return fmt.Errorf("Export of %s failed: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func BucketExport(bpath string, archive string, versions bool, snapviews bool) error {
+	s := strings.Split(bpath, "/")
+
+	md, err := efsutil.GetMDPat(s[0], s[1], s[2], "", "")
+	if err != nil {
+		return fmt.Errorf("Bucket %s: %v", bpath, err)
+	}
+	custom, err := efsutil.GetBucketCustomMD(s[0], s[1], s[2])
+	if err != nil {
+		return fmt.Errorf("Bucket %s: %v", bpath, err)
+	}
+	for k, v := range custom {
+		md[k] = v
+	}
+
+	entries, err := efsutil.ListObjects(s[0], s[1], s[2], "")
+	if err != nil {
+		return err
+	}
+
+	hdr := exportHeader{
+		Format:   exportFormat,
+		Version:  exportVersion,
+		Bucket:   bpath,
+		Created:  time.Now().Unix(),
+		Metadata: md,
+	}
+
+	var names, svNames []string
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name, object.EDGEFS_SNAPVIEW_SUFFIX) {
+			svNames = append(svNames, e.Name)
+			continue
+		}
+		names = append(names, e.Name)
+	}
+	hdr.Objects = len(names)
+
+	snaps := make(map[string][]snapshotSource)
+	if snapviews {
+		for _, sv := range svNames {
+			svmd, err := efsutil.GetMDPat(s[0], s[1], s[2], sv, "")
+			if err != nil {
+				return err
+			}
+			hdr.Snapviews = append(hdr.Snapviews, exportSnapview{Name: sv,
+				Metadata: customMetadata(svmd, object.SnapMetaKeyPrefix)})
+		}
+		snaps, err = exportSnapshots(bpath, svNames)
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Create(archive)
+	if err != nil {
+		return fmt.Errorf("Archive '%s' error: %v", archive, err)
+	}
+
+	var gz *gzip.Writer
+	var w io.Writer = f
+	if strings.HasSuffix(archive, ".gz") {
+		gz = gzip.NewWriter(f)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+
+	err = exportArchive(tw, bpath, hdr, names, versions, snaps)
+
+	// Writers are closed innermost first, each one flushes into the next
+	if cerr := tw.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("Archive '%s' error: %v", archive, cerr)
+	}
+	if gz != nil {
+		if cerr := gz.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("Archive '%s' error: %v", archive, cerr)
+		}
+	}
+	if cerr := f.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("Archive '%s' error: %v", archive, cerr)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Exported %d object(s) of %s to %s\n", len(names), bpath, archive)
+	return nil
+}
+
+var (
+	exportVersions  bool
+	exportSnapviews bool
+
+	exportCmd = &cobra.Command{
+		Use:   "export <cluster>/<tenant>/<bucket> <archive>",
+		Short: "export objects with metadata into an archive",
+		Long: `export every object payload with its system and custom metadata into a
+tar archive (gzip compressed if the name ends with .gz), optionally with
+retained versions and snapshots, to be imported on another cluster`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("Requires <cluster>/<tenant>/<bucket> <archive>")
+			}
+			return validate.Bucket(cmd, args[:1])
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			err := BucketExport(args[0], args[1], exportVersions, exportSnapviews)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	exportCmd.Flags().BoolVarP(&exportVersions, "versions", "", false, "Export retained versions of objects")
+	exportCmd.Flags().BoolVarP(&exportSnapviews, "snapviews", "", false, "Export snapviews and snapshots of objects")
+	BucketCmd.AddCommand(exportCmd)
+}
@@ -0,0 +1,299 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package bucket
+
+/*
+#include "ccow.h"
+*/
+import "C"
+import "unsafe"
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/sabbot/module/efscli/object"
+	"github.com/sabbot/module/efscli/validate"
+	"github.com/spf13/cobra"
+)
+
+// bucketCreateInherit creates the bucket with default attributes taken
+// from the metadata of an exported bucket
+func bucketCreateInherit(bpath string, md map[string]string) error {
+	s := strings.Split(bpath, "/")
+	c_cluster := C.CString(s[0])
+	defer C.free(unsafe.Pointer(c_cluster))
+
+	c_tenant := C.CString(s[1])
+	defer C.free(unsafe.Pointer(c_tenant))
+
+	c_bucket := C.CString(s[2])
+	defer C.free(unsafe.Pointer(c_bucket))
+
+	conf, err := efsutil.GetLibccowConf()
+	if err != nil {
+		return err
+	}
+
+	c_conf := C.CString(string(conf))
+	defer C.free(unsafe.Pointer(c_conf))
+
+	var tc C.ccow_t
+
+	ret := C.ccow_tenant_init(c_conf, c_cluster, C.strlen(c_cluster)+1,
+		c_tenant, C.strlen(c_tenant)+1, &tc)
+	if ret != 0 {
+		return fmt.Errorf("ccow_tenant_init err=%d", ret)
+	}
+	defer C.ccow_tenant_term(tc)
+
+	var c C.ccow_completion_t
+	ret = C.ccow_create_completion(tc, nil, nil, 1, &c)
+	if ret != 0 {
+		return fmt.Errorf("ccow_create_completion err=%d", ret)
+	}
+
+	err = efsutil.InheritBucketAttributes(unsafe.Pointer(c), md)
+	if err != nil {
+		C.ccow_release(c)
+		return err
+	}
+
+	ret = C.ccow_bucket_create(tc, c_bucket, C.strlen(c_bucket)+1, c)
+	if ret != 0 {
+		return fmt.Errorf("bucket_create err=%d", ret)
+	}
+
+	custom := customMetadata(md, "")
+	if len(custom) == 0 {
+		return nil
+	}
+
+	nhid, err := efsutil.GetMDKey(s[0], s[1], s[2], "", "ccow-name-hash-id")
+	if err != nil {
+		return err
+	}
+	return efsutil.UpdateMDMany(s[0], s[1], s[2], nhid, keyValues(custom))
+}
+
+func keyValues(md map[string]string) []efsutil.KeyValue {
+	var res []efsutil.KeyValue
+	for k, v := range md {
+		res = append(res, efsutil.KeyValue{Key: k, Value: v})
+	}
+	return res
+}
+
+// importRevision stages the payload in a temporary file and puts it as a
+// new version of the object
+func importRevision(tr *tar.Reader, opath string, attrs map[string]string) error {
+	tmp, err := ioutil.TempFile("", "efscli-import-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, tr)
+	tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return object.ObjectPut(opath, tmp.Name(), attrs, nil, true)
+}
+
+func importObject(tr *tar.Reader, bpath string, dir string, eo *exportObject) error {
+	opath := bpath + "/" + eo.Name
+
+	for _, rev := range eo.Revisions {
+		hdr, err := tr.Next()
+		if err != nil {
+			return fmt.Errorf("revision %s: %v", rev.File, err)
+		}
+		if hdr.Name != dir+rev.File {
+			return fmt.Errorf("unexpected archive entry %s, expecting %s", hdr.Name, dir+rev.File)
+		}
+
+		err = importRevision(tr, opath, eo.Metadata)
+		if err != nil {
+			return fmt.Errorf("revision %s: %v", rev.File, err)
+		}
+
+		for _, ss := range rev.Snapshots {
+			err = object.SnapshotImport(bpath+"/"+ss.Snapview, object.SnapshotMeta{
+				Name:    opath + "@" + ss.Name,
+				Source:  opath,
+				Created: ss.Created,
+				Tags:    ss.Tags,
+			})
+			if err != nil {
+				return fmt.Errorf("snapshot %s: %v", ss.Name, err)
+			}
+		}
+	}
+
+	custom := customMetadata(eo.Metadata, "")
+	if len(custom) == 0 {
+		return nil
+	}
+	s := strings.SplitN(opath, "/", 4)
+	return efsutil.UpdateMDMany(s[0], s[1], s[2], s[3], keyValues(custom))
+}
+
+func BucketImport(archive string, bpath string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("Archive '%s' error: %v", archive, err)
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("Archive '%s' error: %v", archive, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	th, err := tr.Next()
+	if err != nil || th.Name != exportHeaderName {
+		return fmt.Errorf("Archive '%s' is not a bucket export", archive)
+	}
+
+	var hdr exportHeader
+	err = json.NewDecoder(tr).Decode(&hdr)
+	if err != nil {
+		return fmt.Errorf("Archive '%s' header error: %v", archive, err)
+	}
+	if hdr.Format != exportFormat || hdr.Version > exportVersion {
+		return fmt.Errorf("Archive '%s' has unsupported format %s version %d",
+			archive, hdr.Format, hdr.Version)
+	}
+
+	if bpath == "" {
+		bpath = hdr.Bucket
+	}
+	s := strings.Split(bpath, "/")
+
+	if _, err := efsutil.GetMDPat(s[0], s[1], s[2], "", ""); err == nil {
+		return fmt.Errorf("Bucket %s already exists", bpath)
+	}
+
+	err = bucketCreateInherit(bpath, hdr.Metadata)
+	if err != nil {
+		return err
+	}
+
+	for _, sv := range hdr.Snapviews {
+		err = object.SnapViewCreate(bpath+"/"+sv.Name, nil)
+		if err != nil {
+			return err
+		}
+		if len(sv.Metadata) > 0 {
+			err = efsutil.UpdateMDMany(s[0], s[1], s[2], sv.Name, keyValues(sv.Metadata))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	count := 0
+	for {
+		th, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Archive '%s' error: %v", archive, err)
+		}
+		if !strings.HasSuffix(th.Name, "/meta.json") {
+			return fmt.Errorf("Archive '%s': unexpected entry %s", archive, th.Name)
+		}
+
+		var eo exportObject
+		err = json.NewDecoder(tr).Decode(&eo)
+		if err != nil {
+			return fmt.Errorf("Archive '%s' entry %s error: %v", archive, th.Name, err)
+		}
+
+		err = importObject(tr, bpath, strings.TrimSuffix(th.Name, "meta.json"), &eo)
+		if err != nil {
+			return fmt.Errorf("Import of %s failed: %v", eo.Name, err)
+		}
+		count++
+	}
+
+	if count != hdr.Objects {
+		return fmt.Errorf("Archive '%s' is truncated: %d of %d object(s) imported", archive, count, hdr.Objects)
+	}
+
+	fmt.Printf("Imported %d object(s) from %s to %s\n", count, archive, bpath)
+	return nil
+}
+
+var (
+	importCmd = &cobra.Command{
+		Use:   "import <archive> [<cluster>/<tenant>/<bucket>]",
+		Short: "import objects with metadata from an archive",
+		Long: `create a bucket with the attributes recorded by bucket export and
+recreate its objects, versions and snapshots, the bucket name of the archive
+is used unless another one is given`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 || len(args) > 2 {
+				return fmt.Errorf("Requires <archive> [<cluster>/<tenant>/<bucket>]")
+			}
+			if len(args) == 2 {
+				return validate.Bucket(cmd, args[1:])
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			bpath := ""
+			if len(args) == 2 {
+				bpath = args[1]
+			}
+			err := BucketImport(args[0], bpath)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	BucketCmd.AddCommand(importCmd)
+}
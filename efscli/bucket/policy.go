@@ -0,0 +1,332 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package bucket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/sabbot/module/efscli/validate"
+	"github.com/spf13/cobra"
+)
+
+const (
+	policyKey = "X-Bucket-Policy"
+)
+
+func readPolicyFile(fpath string) ([]byte, error) {
+	if fpath == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(fpath)
+}
+
+func getPolicy(bpath string) ([]byte, error) {
+	s := strings.Split(bpath, "/")
+	md, err := efsutil.GetBucketCustomMD(s[0], s[1], s[2])
+	if err != nil {
+		return nil, fmt.Errorf("Bucket %s: %v", bpath, err)
+	}
+	v, ok := md[policyKey]
+	if !ok || v == "" {
+		return nil, fmt.Errorf("Bucket %s has no policy", bpath)
+	}
+	return []byte(v), nil
+}
+
+// loadPolicy parses the policy file or, if fpath is empty, the policy
+// stored on the bucket
+func loadPolicy(bpath string, fpath string) (*efsutil.Policy, error) {
+	var data []byte
+	var err error
+	if fpath != "" {
+		data, err = readPolicyFile(fpath)
+	} else {
+		data, err = getPolicy(bpath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return efsutil.ParsePolicy(data)
+}
+
+func validatePolicy(bpath string, p *efsutil.Policy) error {
+	bk := strings.Split(bpath, "/")[2]
+	errs := p.Validate(bk)
+	for _, e := range errs {
+		fmt.Printf("ERROR: %v\n", e)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("Policy is not valid, %d error(s)", len(errs))
+	}
+	return nil
+}
+
+func BucketPolicySet(bpath string, fpath string) error {
+	p, err := loadPolicy(bpath, fpath)
+	if err != nil {
+		return err
+	}
+
+	err = validatePolicy(bpath, p)
+	if err != nil {
+		return err
+	}
+
+	// stored compacted, get prints it indented
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	s := strings.Split(bpath, "/")
+	nhid, err := efsutil.GetMDKey(s[0], s[1], s[2], "", "ccow-name-hash-id")
+	if err != nil {
+		return err
+	}
+	err = efsutil.UpdateMD(s[0], s[1], s[2], nhid, policyKey, string(data))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Policy of bucket %s has been set, %d statement(s)\n", bpath, len(p.Statement))
+	return nil
+}
+
+func BucketPolicyGet(bpath string) error {
+	data, err := getPolicy(bpath)
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	err = json.Indent(&out, data, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(out.String())
+	return nil
+}
+
+func BucketPolicyRm(bpath string) error {
+	_, err := getPolicy(bpath)
+	if err != nil {
+		return err
+	}
+
+	s := strings.Split(bpath, "/")
+	nhid, err := efsutil.GetMDKey(s[0], s[1], s[2], "", "ccow-name-hash-id")
+	if err != nil {
+		return err
+	}
+	err = efsutil.UpdateMDMany(s[0], s[1], s[2], nhid, []efsutil.KeyValue{{Key: policyKey, Value: ""}})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Policy of bucket %s has been removed\n", bpath)
+	return nil
+}
+
+func BucketPolicyValidate(bpath string, fpath string) error {
+	p, err := loadPolicy(bpath, fpath)
+	if err != nil {
+		return err
+	}
+
+	err = validatePolicy(bpath, p)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Policy is valid, %d statement(s)\n", len(p.Statement))
+	return nil
+}
+
+func BucketPolicySimulate(bpath string, fpath string, req efsutil.PolicyRequest) error {
+	p, err := loadPolicy(bpath, fpath)
+	if err != nil {
+		return err
+	}
+
+	// plain object keys are turned into ARNs of the bucket
+	bk := strings.Split(bpath, "/")[2]
+	if !strings.HasPrefix(req.Resource, "arn:") {
+		req.Resource = efsutil.PolicyResource(bk, req.Resource)
+	}
+
+	fmt.Printf("User:     %s\n", req.User)
+	fmt.Printf("Action:   %s\n", req.Action)
+	fmt.Printf("Resource: %s\n\n", req.Resource)
+
+	d := p.Evaluate(req)
+	for i, st := range p.Statement {
+		mark := " "
+		if st.Applies(req) {
+			mark = "*"
+		}
+		sid := st.Sid
+		if sid == "" {
+			sid = "-"
+		}
+		fmt.Printf("%s %d %-20s %s\n", mark, i, sid, st.Effect)
+	}
+	fmt.Println()
+
+	decision := "DENY"
+	if d.Allowed {
+		decision = "ALLOW"
+	}
+	fmt.Printf("%s: %s\n", decision, d.Reason)
+	return nil
+}
+
+func policyArgs(n int, usage string) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 || len(args) > n {
+			return fmt.Errorf("Requires %s", usage)
+		}
+		return validate.Bucket(cmd, args)
+	}
+}
+
+var (
+	policyFile    string
+	policySimUser string
+	policySimAct  string
+	policySimRes  string
+
+	policyCmd = &cobra.Command{
+		Use:   "policy",
+		Short: "S3 bucket policy operations",
+		Long:  "set, show, remove, validate and simulate S3 compatible bucket policy documents",
+	}
+
+	policySetCmd = &cobra.Command{
+		Use:   "set <cluster>/<tenant>/<bucket> <policy.json|->",
+		Short: "set bucket policy",
+		Long:  "validate the policy document and store it in the bucket metadata",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("Requires <cluster>/<tenant>/<bucket> <policy.json|->")
+			}
+			return validate.Bucket(cmd, args)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			err := BucketPolicySet(args[0], args[1])
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	policyGetCmd = &cobra.Command{
+		Use:   "get <cluster>/<tenant>/<bucket>",
+		Short: "show bucket policy",
+		Long:  "show bucket policy document",
+		Args:  policyArgs(1, "<cluster>/<tenant>/<bucket>"),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := BucketPolicyGet(args[0])
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	policyRmCmd = &cobra.Command{
+		Use:   "rm <cluster>/<tenant>/<bucket>",
+		Short: "remove bucket policy",
+		Long:  "remove bucket policy document",
+		Args:  policyArgs(1, "<cluster>/<tenant>/<bucket>"),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := BucketPolicyRm(args[0])
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	policyValidateCmd = &cobra.Command{
+		Use:   "validate <cluster>/<tenant>/<bucket> [<policy.json|->]",
+		Short: "validate bucket policy",
+		Long:  "validate a policy document against the bucket, the stored policy is used if no file is given",
+		Args:  policyArgs(2, "<cluster>/<tenant>/<bucket> [<policy.json|->]"),
+		Run: func(cmd *cobra.Command, args []string) {
+			fpath := ""
+			if len(args) == 2 {
+				fpath = args[1]
+			}
+			err := BucketPolicyValidate(args[0], fpath)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	policySimulateCmd = &cobra.Command{
+		Use:   "simulate <cluster>/<tenant>/<bucket>",
+		Short: "simulate a request against bucket policy",
+		Long: `evaluate a request against the bucket policy and show which statements
+apply, an explicit deny wins over any allow and requests no statement
+allows are implicitly denied`,
+		Args: policyArgs(1, "<cluster>/<tenant>/<bucket>"),
+		Run: func(cmd *cobra.Command, args []string) {
+			req := efsutil.PolicyRequest{
+				User:     policySimUser,
+				Action:   policySimAct,
+				Resource: policySimRes,
+			}
+			err := BucketPolicySimulate(args[0], policyFile, req)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	policySimulateCmd.Flags().StringVarP(&policySimUser, "user", "u", "", "User name or ARN of the principal")
+	policySimulateCmd.Flags().StringVarP(&policySimAct, "action", "a", "", "Action, e.g. s3:GetObject")
+	policySimulateCmd.Flags().StringVarP(&policySimRes, "resource", "r", "", "Object key or ARN, the bucket itself by default")
+	policySimulateCmd.Flags().StringVarP(&policyFile, "file", "f", "", "Simulate against a policy file instead of the stored one")
+	policySimulateCmd.MarkFlagRequired("user")
+	policySimulateCmd.MarkFlagRequired("action")
+
+	policyCmd.AddCommand(policySetCmd)
+	policyCmd.AddCommand(policyGetCmd)
+	policyCmd.AddCommand(policyRmCmd)
+	policyCmd.AddCommand(policyValidateCmd)
+	policyCmd.AddCommand(policySimulateCmd)
+	BucketCmd.AddCommand(policyCmd)
+}
@@ -0,0 +1,395 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package bucket
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/sabbot/module/efscli/object"
+	"github.com/sabbot/module/efscli/validate"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+const (
+	snapsetManifestPrefix = ".snapset."
+	snapsetSnapshotPrefix = "snapset-"
+	snapsetSnapView       = ".snapset" + object.EDGEFS_SNAPVIEW_SUFFIX
+)
+
+type snapsetMember struct {
+	Object     string `json:"object"`
+	Snapshot   string `json:"snapshot"`
+	Generation uint64 `json:"generation"`
+}
+
+// snapsetManifest is the JSON payload of the .snapset.<name> object of the
+// bucket and lists snapshots which belong to the set
+type snapsetManifest struct {
+	Name     string          `json:"name"`
+	Bucket   string          `json:"bucket"`
+	Prefix   string          `json:"prefix"`
+	Snapview string          `json:"snapview"`
+	Created  int64           `json:"created"`
+	Members  []snapsetMember `json:"members"`
+}
+
+func snapsetCheckName(name string) error {
+	r, _ := regexp.Compile("^[A-Za-z0-9_.-]+$")
+	if !r.MatchString(name) {
+		return fmt.Errorf("Invalid snapshot set name: %s", name)
+	}
+	// the manifest would be named like a snapview, the default one included
+	if strings.HasSuffix(snapsetManifestPrefix+name, object.EDGEFS_SNAPVIEW_SUFFIX) {
+		return fmt.Errorf("Invalid snapshot set name: %s, it cannot end with %s", name, object.EDGEFS_SNAPVIEW_SUFFIX)
+	}
+	return nil
+}
+
+func snapsetLoad(bpath string, name string) (*snapsetManifest, error) {
+	s := strings.Split(bpath, "/")
+	data, err := efsutil.ObjectGetData(s[0], s[1], s[2], snapsetManifestPrefix+name)
+	if err != nil {
+		return nil, fmt.Errorf("Snapshot set %s not found in %s: %v", name, bpath, err)
+	}
+
+	m := new(snapsetManifest)
+	err = json.Unmarshal(data, m)
+	if err != nil {
+		return nil, fmt.Errorf("Snapshot set %s manifest decoding error: %v", name, err)
+	}
+	return m, nil
+}
+
+// snapsetParallel runs fn for every member using up to jobs workers and
+// returns the failed members
+func snapsetParallel(members []snapsetMember, jobs int, fn func(m snapsetMember) error) []snapsetMember {
+	var failed []snapsetMember
+
+	errs := efsutil.Parallel(len(members), jobs, func(i int) error {
+		return fn(members[i])
+	})
+	for i, err := range errs {
+		if err != nil {
+			fmt.Printf("ERROR: %s: %v\n", members[i].Object, err)
+			failed = append(failed, members[i])
+		}
+	}
+
+	return failed
+}
+
+func SnapshotSetCreate(bpath string, name string, prefix string, snapview string, jobs int) error {
+	err := snapsetCheckName(name)
+	if err != nil {
+		return err
+	}
+
+	s := strings.Split(bpath, "/")
+	if snapview == "" {
+		snapview = bpath + "/" + snapsetSnapView
+	}
+
+	if _, err := efsutil.GetMDKey(s[0], s[1], s[2], snapsetManifestPrefix+name, "ccow-logical-size"); err == nil {
+		return fmt.Errorf("Snapshot set %s already exists in %s", name, bpath)
+	}
+
+	entries, err := efsutil.ListObjects(s[0], s[1], s[2], prefix)
+	if err != nil {
+		return err
+	}
+
+	m := snapsetManifest{
+		Name:     name,
+		Bucket:   bpath,
+		Prefix:   prefix,
+		Snapview: snapview,
+		Created:  time.Now().Unix(),
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name, snapsetManifestPrefix) ||
+			strings.HasSuffix(e.Name, object.EDGEFS_SNAPVIEW_SUFFIX) {
+			continue
+		}
+		opath := bpath + "/" + e.Name
+		m.Members = append(m.Members, snapsetMember{
+			Object:     opath,
+			Snapshot:   opath + "@" + snapsetSnapshotPrefix + name,
+			Generation: e.Generation,
+		})
+	}
+
+	if len(m.Members) == 0 {
+		return fmt.Errorf("No objects found in %s with prefix '%s'", bpath, prefix)
+	}
+
+	// Every member has to be snapshotted at the generation listed above,
+	// the set then matches the bucket as it was at listing time. A member
+	// written to in between fails the set, writers have to be quiesced.
+	sv := strings.SplitN(snapview, "/", 4)
+	tags := map[string]string{"snapset": name}
+	failed := snapsetParallel(m.Members, jobs, func(mb snapsetMember) error {
+		err := object.SnapshotAdd(snapview, mb.Snapshot, tags, nil)
+		if err != nil {
+			return err
+		}
+		e, err := efsutil.GetSnapshotEntry(sv[0], sv[1], sv[2], sv[3], mb.Snapshot)
+		if err == nil && e.Generation != mb.Generation {
+			err = fmt.Errorf("modified while the set was taken, generation %d instead of %d",
+				e.Generation, mb.Generation)
+		}
+		if err != nil {
+			object.SnapshotRm(snapview, mb.Snapshot, nil)
+		}
+		return err
+	})
+
+	if len(failed) > 0 {
+		// a partial set is not consistent, drop what has been taken
+		dropped := make(map[string]bool)
+		for _, f := range failed {
+			dropped[f.Snapshot] = true
+		}
+		for _, mb := range m.Members {
+			if !dropped[mb.Snapshot] {
+				object.SnapshotRm(snapview, mb.Snapshot, nil)
+			}
+		}
+		return fmt.Errorf("Snapshot set %s not created, %d member(s) failed, quiesce writers and retry", name, len(failed))
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = efsutil.ObjectPutData(s[0], s[1], s[2], snapsetManifestPrefix+name, data)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Snapshot set %s of %d object(s) has been created in %s\n", name, len(m.Members), snapview)
+	return nil
+}
+
+func SnapshotSetList(bpath string) error {
+	s := strings.Split(bpath, "/")
+
+	entries, err := efsutil.ListObjects(s[0], s[1], s[2], snapsetManifestPrefix)
+	if err != nil {
+		return err
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetBorder(false)
+	table.SetHeader([]string{"Name", "Created", "Prefix", "Members", "Snapview"})
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name, object.EDGEFS_SNAPVIEW_SUFFIX) {
+			continue
+		}
+		name := strings.TrimPrefix(e.Name, snapsetManifestPrefix)
+		m, err := snapsetLoad(bpath, name)
+		if err != nil {
+			fmt.Printf("ERROR: %v\n", err)
+			continue
+		}
+		table.Append([]string{m.Name, time.Unix(m.Created, 0).Format(time.RFC3339),
+			m.Prefix, fmt.Sprintf("%d", len(m.Members)), m.Snapview})
+	}
+	table.Render()
+
+	return nil
+}
+
+func SnapshotSetRestore(bpath string, name string, force bool, safety bool, jobs int) error {
+	m, err := snapsetLoad(bpath, name)
+	if err != nil {
+		return err
+	}
+
+	inUse := false
+	for _, mb := range m.Members {
+		luns, err := object.ServedLuns(mb.Object)
+		if err != nil {
+			return err
+		}
+		for _, lun := range luns {
+			fmt.Printf("Warning: %s is served as iSCSI LUN %s by service %s (status %s)\n",
+				mb.Object, strings.Split(lun.Entry, "@")[0], lun.Service, lun.Status)
+			inUse = true
+		}
+	}
+	if inUse && !force {
+		return fmt.Errorf("Snapshot set %s has members in use by iSCSI service, unserve them or use --force", name)
+	}
+
+	if safety {
+		sname := name + "-pre-restore-" + time.Now().UTC().Format("20060102-150405")
+		err = SnapshotSetCreate(bpath, sname, m.Prefix, m.Snapview, jobs)
+		if err != nil {
+			return fmt.Errorf("Safety snapshot set failed, restore aborted: %v", err)
+		}
+	}
+
+	failed := snapsetParallel(m.Members, jobs, func(mb snapsetMember) error {
+		return object.SnapshotRestore(m.Snapview, mb.Snapshot, mb.Object)
+	})
+	if len(failed) > 0 {
+		return fmt.Errorf("Snapshot set %s: %d of %d member(s) not restored", name, len(failed), len(m.Members))
+	}
+
+	fmt.Printf("Snapshot set %s of %d object(s) has been restored\n", name, len(m.Members))
+	return nil
+}
+
+func SnapshotSetDelete(bpath string, name string, jobs int) error {
+	m, err := snapsetLoad(bpath, name)
+	if err != nil {
+		return err
+	}
+
+	failed := snapsetParallel(m.Members, jobs, func(mb snapsetMember) error {
+		return object.SnapshotRm(m.Snapview, mb.Snapshot, nil)
+	})
+	if len(failed) > 0 {
+		return fmt.Errorf("Snapshot set %s: %d of %d member(s) not removed, manifest kept", name, len(failed), len(m.Members))
+	}
+
+	s := strings.Split(bpath, "/")
+	err = efsutil.ObjectExpunge(s[0], s[1], s[2], snapsetManifestPrefix+name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Snapshot set %s has been deleted\n", name)
+	return nil
+}
+
+func snapsetArgs(n int, usage string) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if len(args) != n {
+			return fmt.Errorf("Requires %s", usage)
+		}
+		return validate.Bucket(cmd, args)
+	}
+}
+
+var (
+	snapsetPrefix   string
+	snapsetSnapview string
+	snapsetJobs     int
+	snapsetForce    bool
+	snapsetNoSafety bool
+
+	snapshotCmd = &cobra.Command{
+		Use:   "snapshot",
+		Short: "bucket wide snapshot sets",
+		Long:  "snapshot all objects of a bucket, or under a prefix, as one set",
+	}
+
+	snapshotCreateCmd = &cobra.Command{
+		Use:   "create <cluster>/<tenant>/<bucket> <name>",
+		Short: "create a snapshot set",
+		Long: `snapshot every object of the bucket into a snapview and record the set in a manifest object
+
+The set is consistent: every member is snapshotted at the generation it had
+when the bucket was listed. If an object is written to while the set is
+taken, the set is dropped and the command fails, so writers (iSCSI, NFS or
+S3 clients) have to be quiesced for the duration of the command.`,
+		Args: snapsetArgs(2, "<cluster>/<tenant>/<bucket> <name>"),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := SnapshotSetCreate(args[0], args[1], snapsetPrefix, snapsetSnapview, snapsetJobs)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	snapshotListCmd = &cobra.Command{
+		Use:   "list <cluster>/<tenant>/<bucket>",
+		Short: "list snapshot sets",
+		Long:  "list snapshot sets of a bucket",
+		Args:  snapsetArgs(1, "<cluster>/<tenant>/<bucket>"),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := SnapshotSetList(args[0])
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	snapshotRestoreCmd = &cobra.Command{
+		Use:   "restore <cluster>/<tenant>/<bucket> <name>",
+		Short: "restore a snapshot set",
+		Long:  "roll every member object back to its snapshot, a safety set of the current state is taken first",
+		Args:  snapsetArgs(2, "<cluster>/<tenant>/<bucket> <name>"),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := SnapshotSetRestore(args[0], args[1], snapsetForce, !snapsetNoSafety, snapsetJobs)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	snapshotDeleteCmd = &cobra.Command{
+		Use:   "delete <cluster>/<tenant>/<bucket> <name>",
+		Short: "delete a snapshot set",
+		Long:  "remove all member snapshots and the manifest of a snapshot set",
+		Args:  snapsetArgs(2, "<cluster>/<tenant>/<bucket> <name>"),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := SnapshotSetDelete(args[0], args[1], snapsetJobs)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	snapshotCreateCmd.Flags().StringVarP(&snapsetPrefix, "prefix", "p", "", "Only snapshot objects under the prefix")
+	snapshotCreateCmd.Flags().StringVarP(&snapsetSnapview, "snapview", "s", "", "Snapview object, <bucket>/"+snapsetSnapView+" by default")
+	snapshotRestoreCmd.Flags().BoolVarP(&snapsetForce, "force", "f", false, "Restore even if members are served as iSCSI LUNs")
+	snapshotRestoreCmd.Flags().BoolVarP(&snapsetNoSafety, "no-safety", "", false, "Do not take a safety set before restore")
+
+	for _, c := range []*cobra.Command{snapshotCreateCmd, snapshotRestoreCmd, snapshotDeleteCmd} {
+		c.Flags().IntVarP(&snapsetJobs, "jobs", "j", 16, "Number of objects to process in parallel")
+	}
+
+	snapshotCmd.AddCommand(snapshotCreateCmd)
+	snapshotCmd.AddCommand(snapshotListCmd)
+	snapshotCmd.AddCommand(snapshotRestoreCmd)
+	snapshotCmd.AddCommand(snapshotDeleteCmd)
+	BucketCmd.AddCommand(snapshotCmd)
+}
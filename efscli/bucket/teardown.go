@@ -0,0 +1,243 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package bucket
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/sabbot/module/efscli/service"
+)
+
+// Teardown is the inventory of a cluster, tenant or bucket namespace which
+// is about to be deleted recursively
+type Teardown struct {
+	Namespace string
+	Tenants   []string
+	Buckets   []string
+	Objects   map[string][]string
+	Users     map[string][]*efsutil.User
+	Entries   []efsutil.ServiceEntry
+}
+
+func (t *Teardown) contains(path string) bool {
+	return path == t.Namespace || strings.HasPrefix(path, t.Namespace+"/")
+}
+
+// NewTeardown enumerates tenants, users, buckets, objects and service
+// entries under the namespace, nothing is modified
+func NewTeardown(namespace string) (*Teardown, error) {
+	t := &Teardown{
+		Namespace: namespace,
+		Objects:   make(map[string][]string),
+		Users:     make(map[string][]*efsutil.User),
+	}
+
+	s := strings.Split(namespace, "/")
+	switch len(s) {
+	case 1:
+		tenants, err := efsutil.GetTenants(s[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, tn := range tenants {
+			t.Tenants = append(t.Tenants, s[0]+"/"+tn)
+		}
+	case 2:
+		t.Tenants = []string{namespace}
+	case 3:
+		t.Buckets = []string{namespace}
+	}
+
+	for _, tpath := range t.Tenants {
+		ts := strings.Split(tpath, "/")
+
+		users, err := efsutil.GetUsers(ts[0], ts[1])
+		if err != nil {
+			return nil, err
+		}
+		t.Users[tpath] = users
+
+		buckets, err := efsutil.GetBuckets(ts[0], ts[1])
+		if err != nil {
+			return nil, err
+		}
+		for _, bk := range buckets {
+			t.Buckets = append(t.Buckets, tpath+"/"+bk)
+		}
+	}
+
+	for _, bpath := range t.Buckets {
+		bs := strings.Split(bpath, "/")
+		entries, err := efsutil.ListObjects(bs[0], bs[1], bs[2], "")
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			t.Objects[bpath] = append(t.Objects[bpath], e.Name)
+		}
+	}
+
+	entries, err := efsutil.GetServiceEntries("")
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !t.contains(efsutil.ServiceObjectPath(e.Type, e.Entry)) {
+			continue
+		}
+		err = service.CheckUnserve(e)
+		if err != nil {
+			return nil, err
+		}
+		t.Entries = append(t.Entries, e)
+	}
+
+	return t, nil
+}
+
+// Print shows everything Run is going to remove
+func (t *Teardown) Print() {
+	fmt.Printf("Recursive delete of %s\n\n", t.Namespace)
+
+	fmt.Printf("Service entries to unserve: %d\n", len(t.Entries))
+	for _, e := range t.Entries {
+		fmt.Printf("  %s (%s) %s\n", e.Service, e.Type, e.Entry)
+	}
+
+	nusers := 0
+	for _, tpath := range t.Tenants {
+		nusers += len(t.Users[tpath])
+	}
+	fmt.Printf("Users to delete: %d\n", nusers)
+	for _, tpath := range t.Tenants {
+		for _, u := range t.Users[tpath] {
+			fmt.Printf("  %s %s\n", tpath, u.Username)
+		}
+	}
+
+	nobjects := 0
+	for _, bpath := range t.Buckets {
+		nobjects += len(t.Objects[bpath])
+	}
+	fmt.Printf("Buckets to delete: %d, objects: %d\n", len(t.Buckets), nobjects)
+	for _, bpath := range t.Buckets {
+		fmt.Printf("  %s (%d objects)\n", bpath, len(t.Objects[bpath]))
+	}
+
+	if len(t.Tenants) > 0 {
+		fmt.Printf("Tenants to delete: %d\n", len(t.Tenants))
+		for _, tpath := range t.Tenants {
+			fmt.Printf("  %s\n", tpath)
+		}
+	}
+	fmt.Println()
+}
+
+// teardownParallel runs fn for every item using up to jobs workers and
+// returns the number of failures
+func teardownParallel(items []string, jobs int, fn func(item string) error) int {
+	var failed int
+
+	errs := efsutil.Parallel(len(items), jobs, func(i int) error {
+		return fn(items[i])
+	})
+	for i, err := range errs {
+		if err != nil {
+			fmt.Printf("ERROR: %s: %v\n", items[i], err)
+			failed++
+		}
+	}
+
+	return failed
+}
+
+// Run unserves service entries and deletes objects, buckets and users bottom
+// up. Tenants and the cluster are left to the caller. A bucket is kept if
+// any of its objects could not be deleted.
+func (t *Teardown) Run(jobs int) error {
+	for _, e := range t.Entries {
+		err := service.UnserveEntry(e)
+		if err != nil {
+			return fmt.Errorf("Unserve of %s from %s failed: %v", e.Entry, e.Service, err)
+		}
+	}
+
+	var objects []string
+	for _, bpath := range t.Buckets {
+		for _, obj := range t.Objects[bpath] {
+			objects = append(objects, bpath+"/"+obj)
+		}
+	}
+
+	var mu sync.Mutex
+	dirty := make(map[string]bool)
+	teardownParallel(objects, jobs, func(opath string) error {
+		s := strings.SplitN(opath, "/", 4)
+		err := efsutil.ObjectExpunge(s[0], s[1], s[2], s[3])
+		if err != nil {
+			mu.Lock()
+			dirty[strings.Join(s[:3], "/")] = true
+			mu.Unlock()
+		}
+		return err
+	})
+
+	var buckets []string
+	for _, bpath := range t.Buckets {
+		if !dirty[bpath] {
+			buckets = append(buckets, bpath)
+		}
+	}
+	failed := len(t.Buckets) - len(buckets)
+	failed += teardownParallel(buckets, jobs, BucketDelete)
+	if failed > 0 {
+		return fmt.Errorf("%d bucket(s) of %s not deleted", failed, t.Namespace)
+	}
+
+	for _, tpath := range t.Tenants {
+		s := strings.Split(tpath, "/")
+		for _, u := range t.Users[tpath] {
+			err := efsutil.DeleteUser(s[0], s[1], u)
+			if err != nil {
+				return fmt.Errorf("User %s of %s not deleted: %v", u.Username, tpath, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Confirm prints the inventory and asks for the namespace name, nothing is
+// confirmed on a dry run
+func (t *Teardown) Confirm(dryRun bool) bool {
+	t.Print()
+	if dryRun {
+		fmt.Println("Dry run, nothing has been deleted")
+		return false
+	}
+	return efsutil.ConfirmByName("All of the above will be permanently deleted.", t.Namespace)
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package bucket
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/sabbot/module/efscli/object"
+	"github.com/sabbot/module/efscli/validate"
+
+	"github.com/im-kulikov/sizefmt"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+const (
+	quotaBytesKey = "X-container-meta-quota-bytes"
+	quotaCountKey = "X-container-meta-quota-count"
+)
+
+// Usage is the consumption of a bucket, or a roll up of several, along
+// with the configured quotas, zero quota means unlimited
+type Usage struct {
+	Name       string
+	Bytes      uint64
+	Objects    uint64
+	Versions   uint64
+	Snapviews  uint64
+	QuotaBytes uint64
+	QuotaCount uint64
+}
+
+func (u *Usage) Add(o *Usage) {
+	u.Bytes += o.Bytes
+	u.Objects += o.Objects
+	u.Versions += o.Versions
+	u.Snapviews += o.Snapviews
+}
+
+// Quotas reads quota custom attributes from metadata
+func (u *Usage) Quotas(md map[string]string) {
+	u.QuotaBytes, _ = strconv.ParseUint(md[quotaBytesKey], 10, 64)
+	u.QuotaCount, _ = strconv.ParseUint(md[quotaCountKey], 10, 64)
+}
+
+// GetBucketUsage walks the name index of the bucket. Retained versions are
+// estimated from object generations capped by number-of-versions.
+func GetBucketUsage(cl string, tn string, bk string) (*Usage, error) {
+	md, err := efsutil.GetMDPat(cl, tn, bk, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("Bucket %s/%s/%s: %v", cl, tn, bk, err)
+	}
+
+	entries, err := efsutil.ListObjects(cl, tn, bk, "")
+	if err != nil {
+		return nil, err
+	}
+
+	nv, _ := strconv.ParseUint(md["ccow-number-of-versions"], 10, 64)
+	if nv == 0 {
+		nv = 1
+	}
+
+	custom, err := efsutil.GetBucketCustomMD(cl, tn, bk)
+	if err != nil {
+		return nil, fmt.Errorf("Bucket %s/%s/%s: %v", cl, tn, bk, err)
+	}
+
+	u := &Usage{Name: bk}
+	u.Quotas(custom)
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name, object.EDGEFS_SNAPVIEW_SUFFIX) {
+			u.Snapviews++
+			continue
+		}
+		u.Objects++
+		u.Bytes += e.Size
+		if e.Generation < nv {
+			u.Versions += e.Generation
+		} else {
+			u.Versions += nv
+		}
+	}
+	return u, nil
+}
+
+func usagePercent(used uint64, quota uint64) float64 {
+	if quota == 0 {
+		return 0
+	}
+	return float64(used) * 100 / float64(quota)
+}
+
+func formatUsageBytes(v uint64) string {
+	return strings.Trim(sizefmt.ByteSize(float64(v)), " ")
+}
+
+// formatQuota prints quota and percentage, "-" stands for no quota
+func formatQuota(used uint64, quota uint64, bytes bool) (string, string) {
+	if quota == 0 {
+		return "-", "-"
+	}
+	q := strconv.FormatUint(quota, 10)
+	if bytes {
+		q = formatUsageBytes(quota)
+	}
+	return q, fmt.Sprintf("%.1f%%", usagePercent(used, quota))
+}
+
+// Percents returns used percentage of the bytes and count quotas
+func (u *Usage) Percents() (string, string) {
+	_, pb := formatQuota(u.Bytes, u.QuotaBytes, true)
+	_, pc := formatQuota(u.Objects, u.QuotaCount, false)
+	return pb, pc
+}
+
+// UsageWarnings prints a warning for every quota consumed at or above the
+// threshold percentage and returns their number
+func UsageWarnings(kind string, u *Usage, threshold float64) int {
+	n := 0
+	check := func(what string, used uint64, quota uint64) {
+		p := usagePercent(used, quota)
+		if quota == 0 || p < threshold {
+			return
+		}
+		state := "reached"
+		if p >= 100 {
+			state = "exceeded"
+		}
+		fmt.Printf("Warning: %s %s %s quota %s, %.1f%% used\n", kind, u.Name, what, state, p)
+		n++
+	}
+	check("bytes", u.Bytes, u.QuotaBytes)
+	check("count", u.Objects, u.QuotaCount)
+	return n
+}
+
+// PrintUsage prints consumption of u against its quotas
+func PrintUsage(u *Usage) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetBorder(false)
+	table.SetHeader([]string{"Metric", "Used", "Quota", "Used %"})
+
+	q, p := formatQuota(u.Bytes, u.QuotaBytes, true)
+	table.Append([]string{"Logical bytes", formatUsageBytes(u.Bytes), q, p})
+	q, p = formatQuota(u.Objects, u.QuotaCount, false)
+	table.Append([]string{"Objects", strconv.FormatUint(u.Objects, 10), q, p})
+	table.Append([]string{"Versions", strconv.FormatUint(u.Versions, 10), "-", "-"})
+	table.Append([]string{"Snapviews", strconv.FormatUint(u.Snapviews, 10), "-", "-"})
+	table.Render()
+}
+
+func BucketUsage(bpath string, threshold float64) error {
+	s := strings.Split(bpath, "/")
+
+	u, err := GetBucketUsage(s[0], s[1], s[2])
+	if err != nil {
+		return err
+	}
+
+	PrintUsage(u)
+	UsageWarnings("bucket", u, threshold)
+	return nil
+}
+
+var (
+	usageThreshold float64
+
+	usageCmd = &cobra.Command{
+		Use:   "usage <cluster>/<tenant>/<bucket>",
+		Short: "show bucket usage versus quotas",
+		Long:  "show logical bytes, object, version and snapview counts of a bucket against its quotas",
+		Args:  validate.Bucket,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := BucketUsage(args[0], usageThreshold)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	usageCmd.Flags().Float64VarP(&usageThreshold, "threshold", "w", 80, "Warn when quota usage reaches the percentage")
+	BucketCmd.AddCommand(usageCmd)
+}
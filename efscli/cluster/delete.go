@@ -30,7 +30,9 @@ import "C"
 import "unsafe"
 
 import (
+	"github.com/sabbot/module/efscli/bucket"
 	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/sabbot/module/efscli/tenant"
 	"github.com/sabbot/module/efscli/validate"
 	"fmt"
 	"github.com/spf13/cobra"
@@ -68,14 +70,50 @@ func ClusterDelete(clname string) error {
 	return nil
 }
 
+// ClusterDeleteRecursive tears down every tenant of the cluster and then
+// deletes the cluster itself
+func ClusterDeleteRecursive(clname string, dryRun bool, jobs int) error {
+	t, err := bucket.NewTeardown(clname)
+	if err != nil {
+		return err
+	}
+
+	if !t.Confirm(dryRun) {
+		return nil
+	}
+
+	err = t.Run(jobs)
+	if err != nil {
+		return err
+	}
+
+	for _, tpath := range t.Tenants {
+		err = tenant.TenantDelete(tpath)
+		if err != nil {
+			return fmt.Errorf("Tenant %s not deleted: %v", tpath, err)
+		}
+	}
+
+	return ClusterDelete(clname)
+}
+
 var (
+	deleteRecursive bool
+	deleteDryRun    bool
+	deleteJobs      int
+
 	deleteCmd = &cobra.Command{
 		Use:   "delete",
 		Short: "delete an existing cluster namespace",
 		Long:  "delete an existing cluster namespace",
 		Args:  validate.Cluster,
 		Run: func(cmd *cobra.Command, args []string) {
-			err := ClusterDelete(args[0])
+			var err error
+			if deleteRecursive || deleteDryRun {
+				err = ClusterDeleteRecursive(args[0], deleteDryRun, deleteJobs)
+			} else {
+				err = ClusterDelete(args[0])
+			}
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
@@ -85,5 +123,8 @@ var (
 )
 
 func init() {
+	deleteCmd.Flags().BoolVarP(&deleteRecursive, "recursive", "r", false, "Unserve and delete all tenants, buckets, objects and users first")
+	deleteCmd.Flags().BoolVarP(&deleteDryRun, "dry-run", "", false, "Only show what a recursive delete would remove")
+	deleteCmd.Flags().IntVarP(&deleteJobs, "jobs", "j", 16, "Number of parallel deletes")
 	ClusterCmd.AddCommand(deleteCmd)
 }
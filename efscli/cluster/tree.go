@@ -0,0 +1,272 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sabbot/module/efscli/bucket"
+	"github.com/sabbot/module/efscli/efsutil"
+
+	"github.com/im-kulikov/sizefmt"
+	"github.com/spf13/cobra"
+)
+
+type treeNode struct {
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Objects    *uint64           `json:"objects,omitempty"`
+	Bytes      *uint64           `json:"bytes,omitempty"`
+	Children   []*treeNode       `json:"children,omitempty"`
+}
+
+// treeAttributes picks the attributes shown for every node, those which
+// are not set are left out
+func treeAttributes(md map[string]string) map[string]string {
+	res := make(map[string]string)
+	if v, ok := md["ccow-replication-count"]; ok {
+		res["replication-count"] = v
+	}
+	if v, ok := md["ccow-number-of-versions"]; ok {
+		res["versions"] = v
+	}
+	if md["ccow-ec-enabled"] == "1" {
+		var m efsutil.ECMode
+		code, _ := strconv.Atoi(md["ccow-ec-data-mode"])
+		if m.Decode(code) == nil {
+			res["ec"] = m.String()
+		}
+	}
+	if v, ok := md["X-container-meta-quota-bytes"]; ok {
+		res["quota"] = v
+	}
+	if v, ok := md["X-container-meta-quota-count"]; ok {
+		res["quota-count"] = v
+	}
+	return res
+}
+
+func (n *treeNode) addCounts(objects uint64, bytes uint64) {
+	if n.Objects == nil {
+		n.Objects = new(uint64)
+		n.Bytes = new(uint64)
+	}
+	*n.Objects += objects
+	*n.Bytes += bytes
+}
+
+// buildTree loads the node and its children down to depth levels, 0 means
+// no limit. Counts of buckets are rolled up into their parents.
+func buildTree(path string, depth int, counts bool) (*treeNode, error) {
+	s := strings.Split(path, "/")
+	n := &treeNode{Name: s[len(s)-1]}
+
+	var md map[string]string
+	var children []string
+	var err error
+	switch len(s) {
+	case 1:
+		n.Type = "cluster"
+		md, _ = efsutil.GetMDPat(s[0], "", "", "", "")
+		children, err = efsutil.GetTenants(s[0])
+	case 2:
+		n.Type = "tenant"
+		md, err = efsutil.GetMDPat(s[0], s[1], "", "", "")
+		if err == nil {
+			children, err = efsutil.GetBuckets(s[0], s[1])
+		}
+	case 3:
+		n.Type = "bucket"
+		md, err = efsutil.GetMDPat(s[0], s[1], s[2], "", "")
+		if err == nil {
+			// quotas are custom attributes of the name hash id object
+			var custom map[string]string
+			custom, err = efsutil.GetBucketCustomMD(s[0], s[1], s[2])
+			for k, v := range custom {
+				md[k] = v
+			}
+		}
+		if err == nil && counts {
+			var u *bucket.Usage
+			u, err = bucket.GetBucketUsage(s[0], s[1], s[2])
+			if err == nil {
+				n.addCounts(u.Objects, u.Bytes)
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	n.Attributes = treeAttributes(md)
+
+	// below the depth limit children are still walked for the counts
+	hidden := depth == 1
+	if hidden && !counts {
+		return n, nil
+	}
+	if depth > 1 {
+		depth--
+	} else {
+		depth = 0
+	}
+
+	for _, c := range children {
+		child, err := buildTree(path+"/"+c, depth, counts)
+		if err != nil {
+			return nil, err
+		}
+		if child.Objects != nil {
+			n.addCounts(*child.Objects, *child.Bytes)
+		}
+		if !hidden {
+			n.Children = append(n.Children, child)
+		}
+	}
+	return n, nil
+}
+
+func (n *treeNode) label() string {
+	var attrs []string
+	for _, k := range []string{"replication-count", "ec", "versions", "quota", "quota-count"} {
+		if v, ok := n.Attributes[k]; ok {
+			if k == "quota" {
+				b, _ := strconv.ParseUint(v, 10, 64)
+				v = strings.Trim(sizefmt.ByteSize(float64(b)), " ")
+			}
+			attrs = append(attrs, k+"="+v)
+		}
+	}
+
+	res := n.Name
+	if len(attrs) > 0 {
+		res += "  [" + strings.Join(attrs, " ") + "]"
+	}
+	if n.Objects != nil {
+		res += fmt.Sprintf("  %d objects, %s", *n.Objects,
+			strings.Trim(sizefmt.ByteSize(float64(*n.Bytes)), " "))
+	}
+	return res
+}
+
+func (n *treeNode) print(prefix string, last bool, root bool) {
+	if root {
+		fmt.Println(n.label())
+	} else if last {
+		fmt.Println(prefix + "└── " + n.label())
+		prefix += "    "
+	} else {
+		fmt.Println(prefix + "├── " + n.label())
+		prefix += "│   "
+	}
+
+	for i, c := range n.Children {
+		c.print(prefix, i == len(n.Children)-1, false)
+	}
+}
+
+func ClusterTree(path string, depth int, counts bool, output string) error {
+	var roots []string
+	if path != "" {
+		roots = []string{path}
+	} else {
+		clusters, err := efsutil.GetClusters()
+		if err != nil {
+			return err
+		}
+		roots = clusters
+	}
+
+	var nodes []*treeNode
+	for _, r := range roots {
+		n, err := buildTree(r, depth, counts)
+		if err != nil {
+			return err
+		}
+		nodes = append(nodes, n)
+	}
+
+	if output == "json" {
+		data, err := json.MarshalIndent(nodes, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	for _, n := range nodes {
+		n.print("", true, true)
+	}
+	return nil
+}
+
+var (
+	treeDepth  int
+	treeCounts bool
+	treeOutput string
+
+	treeCmd = &cobra.Command{
+		Use:   "tree [<cluster>[/<tenant>]]",
+		Short: "show namespace hierarchy",
+		Long:  "show cluster, tenant and bucket hierarchy with key attributes and optional object counts",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				return fmt.Errorf("Requires at most one [<cluster>[/<tenant>]] argument")
+			}
+			if len(args) == 1 {
+				s := strings.Split(args[0], "/")
+				if len(s) > 2 || s[0] == "" || (len(s) == 2 && s[1] == "") {
+					return fmt.Errorf("Invalid namespace specified: %s", args[0])
+				}
+			}
+			if treeOutput != "" && treeOutput != "json" {
+				return fmt.Errorf("Unsupported output format %s", treeOutput)
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			path := ""
+			if len(args) == 1 {
+				path = args[0]
+			}
+			err := ClusterTree(path, treeDepth, treeCounts, treeOutput)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	treeCmd.Flags().IntVarP(&treeDepth, "depth", "d", 0, "Number of levels to show, 0 for all")
+	treeCmd.Flags().BoolVarP(&treeCounts, "counts", "c", false, "Show object counts and logical bytes")
+	treeCmd.Flags().StringVarP(&treeOutput, "output", "o", "", "Output format, json")
+	ClusterCmd.AddCommand(treeCmd)
+}
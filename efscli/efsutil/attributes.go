@@ -155,6 +155,34 @@ func ReadAttributes(cmd *cobra.Command, flagNames []string, flags []FlagValue) {
 	return
 }
 
+// NewFlags returns the named attribute flags with values set, as they
+// would be after ReadAttributes and command line parsing
+func NewFlags(flagNames []string, values map[string]string) ([]FlagValue, error) {
+	flags := make([]FlagValue, len(flagNames))
+	for i := 0; i < len(flagNames); i++ {
+		f, exists := flagMap[flagNames[i]]
+		if !exists {
+			return nil, fmt.Errorf("Flag %s not found!", flagNames[i])
+		}
+		flags[i] = f
+		flags[i].Value = values[flagNames[i]]
+	}
+
+	for name := range values {
+		found := false
+		for _, n := range flagNames {
+			if n == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Attribute %s is not supported here", name)
+		}
+	}
+	return flags, nil
+}
+
 func isNumber(s string) bool {
 	r, _ := regexp.Compile("^[0-9]+$")
 	return r.MatchString(s)
@@ -306,6 +334,18 @@ func ModifyCustomAttributes(cl string, tn string, bk string, obj string, flags [
 	return UpdateMDMany(cl, tn, bk, obj, par)
 }
 
+// NewDataOnlyAttributes returns names of the non-empty flags which are
+// only applied to data written after they have been changed
+func NewDataOnlyAttributes(flags []FlagValue) []string {
+	var res []string
+	for i := 0; i < len(flags); i++ {
+		if flags[i].Value != "" && flags[i].Attr != CUSTOM_ATTRIBUTES {
+			res = append(res, flags[i].Name)
+		}
+	}
+	return res
+}
+
 func ModifyDefaultAttributes(c unsafe.Pointer, flags []FlagValue) error {
 	for i := 0; i < len(flags); i++ {
 
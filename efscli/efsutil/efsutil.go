@@ -81,6 +81,21 @@ func AskForConfirmation(s string) bool {
 	}
 }
 
+// ConfirmByName asks the user to type the name of the object about to be
+// destroyed, anything else cancels
+func ConfirmByName(s string, name string) bool {
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Printf("%s\nType '%s' to confirm: ", s, name)
+
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSpace(response) == name
+}
+
 func GetFUNC(depthList ...int) string {
 	var depth int
 	if depthList == nil {
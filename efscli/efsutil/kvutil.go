@@ -34,9 +34,15 @@ import "unsafe"
 
 import (
 	"fmt"
+	"strings"
 )
 
 func GetKeys(cl string, tn string, bk string, obj string, count int) ([]string, error) {
+	return GetKeysFrom(cl, tn, bk, obj, "", count)
+}
+
+// GetKeysFrom returns up to count keys of the name index starting at marker
+func GetKeysFrom(cl string, tn string, bk string, obj string, marker string, count int) ([]string, error) {
 	var res []string
 
 	conf, err := GetLibccowConf()
@@ -70,6 +76,9 @@ func GetKeys(cl string, tn string, bk string, obj string, count int) ([]string,
 	c_obj := C.CString(obj)
 	defer C.free(unsafe.Pointer(c_obj))
 
+	c_marker := C.CString(marker)
+	defer C.free(unsafe.Pointer(c_marker))
+
 	var comp C.ccow_completion_t
 	ret = C.ccow_create_completion(tc, nil, nil, 1, &comp)
 	if ret != 0 {
@@ -77,8 +86,8 @@ func GetKeys(cl string, tn string, bk string, obj string, count int) ([]string,
 	}
 
 	var iov_name C.struct_iovec
-	iov_name.iov_base = unsafe.Pointer(clempty)
-	iov_name.iov_len = 1
+	iov_name.iov_base = unsafe.Pointer(c_marker)
+	iov_name.iov_len = C.strlen(c_marker) + 1
 
 	var iter C.ccow_lookup_t
 
@@ -116,6 +125,34 @@ func GetKeys(cl string, tn string, bk string, obj string, count int) ([]string,
 	return res, nil
 }
 
+// ListKeys returns all keys of the name index, fetching them in pages of
+// 1000 entries
+func ListKeys(cl string, tn string, bk string, obj string) ([]string, error) {
+	var res []string
+	var marker string
+	for {
+		keys, err := GetKeysFrom(cl, tn, bk, obj, marker, 1000)
+		if err != nil {
+			return res, err
+		}
+		n := 0
+		for _, k := range keys {
+			// a page starts at the marker itself
+			if marker != "" && k <= marker {
+				continue
+			}
+			res = append(res, k)
+			n++
+		}
+		if n == 0 {
+			break
+		}
+		marker = res[len(res)-1]
+	}
+	return res, nil
+}
+
+
 func GetKeyValues(cl string, tn string, bk string, obj string, pat string, max_len int, count int) ([]KeyValue, error) {
 	var res []KeyValue
 	conf, err := GetLibccowConf()
@@ -230,3 +267,295 @@ func GetKeyValues(cl string, tn string, bk string, obj string, pat string, max_l
 
 	return res, nil
 }
+
+type ObjectEntry struct {
+	Name       string
+	Deleted    bool
+	Timestamp  uint64
+	Generation uint64
+	VMChid     string
+	Size       uint64
+}
+
+// unpackObjectEntry decodes a name index entry, ok is false for entries
+// which are not version 1 object entries
+func unpackObjectEntry(kv *C.struct_ccow_metadata_kv) (ObjectEntry, bool, error) {
+	e := ObjectEntry{Name: C.GoString(kv.key)}
+
+	u, _ := C.msgpack_unpack_init(kv.value, C.uint(kv.value_size), 0)
+	if u == nil {
+		return e, false, fmt.Errorf("%s: unpack init failed", GetFUNC())
+	}
+	defer C.msgpack_unpack_free(u)
+
+	var ver C.uint8_t
+	r, _ := C.msgpack_unpack_uint8(u, &ver)
+	if r != 0 {
+		return e, false, fmt.Errorf("%s: unpack version err=%d", GetFUNC(), r)
+	}
+	if ver != 1 {
+		return e, false, nil
+	}
+
+	var object_deleted C.uint8_t
+	r, _ = C.msgpack_unpack_uint8(u, &object_deleted)
+	if r != 0 {
+		return e, false, fmt.Errorf("%s: unpack object err=%d", GetFUNC(), r)
+	}
+
+	var timestamp C.uint64_t
+	r, _ = C.msgpack_unpack_uint64(u, &timestamp)
+	if r != 0 {
+		return e, false, fmt.Errorf("%s: unpack object timestamp err=%d", GetFUNC(), r)
+	}
+
+	var generation C.uint64_t
+	r, _ = C.msgpack_unpack_uint64(u, &generation)
+	if r != 0 {
+		return e, false, fmt.Errorf("%s: unpack object generation err=%d", GetFUNC(), r)
+	}
+
+	var vmchid C.uint512_t
+	r, _ = C.msgpack_unpack_uint512(u, &vmchid)
+	if r != 0 {
+		return e, false, fmt.Errorf("%s: unpack object vmchid err=%d", GetFUNC(), r)
+	}
+
+	c_buf := (*C.char)(C.malloc(C.UINT512_BYTES*2 + 1))
+	defer C.free(unsafe.Pointer(c_buf))
+
+	C.uint512_dump(&vmchid, c_buf, C.UINT512_BYTES*2+1)
+	schid := C.GoString(c_buf)
+
+	r, _ = C.msgpack_unpack_str(u, c_buf, 128)
+	if r != 0 {
+		return e, false, fmt.Errorf("%s: unpack object etag=%d", GetFUNC(), r)
+	}
+
+	r, _ = C.msgpack_unpack_str(u, c_buf, 128)
+	if r != 0 {
+		return e, false, fmt.Errorf("%s: unpack object content_type=%d", GetFUNC(), r)
+	}
+
+	var size C.uint64_t
+	r, _ = C.msgpack_unpack_uint64(u, &size)
+	if r != 0 {
+		return e, false, fmt.Errorf("%s: unpack object size err=%d", GetFUNC(), r)
+	}
+
+	e.Deleted = object_deleted != 0
+	e.Timestamp = uint64(timestamp)
+	e.Generation = uint64(generation)
+	e.VMChid = schid
+	e.Size = uint64(size)
+	return e, true, nil
+}
+
+func GetObjectEntries(cl string, tn string, bk string, obj string, pat string, cmp int, count int) ([]ObjectEntry, error) {
+	var res []ObjectEntry
+	conf, err := GetLibccowConf()
+	if err != nil {
+		return res, err
+	}
+
+	c_pat := C.CString(pat)
+	defer C.free(unsafe.Pointer(c_pat))
+
+	c_conf := C.CString(string(conf))
+	defer C.free(unsafe.Pointer(c_conf))
+
+	clempty := C.CString("")
+	defer C.free(unsafe.Pointer(clempty))
+
+	var tc C.ccow_t
+
+	ret := C.ccow_admin_init(c_conf, clempty, 1, &tc)
+	if ret != 0 {
+		return res, fmt.Errorf("ccow_admin_init err=%d", ret)
+	}
+	defer C.ccow_tenant_term(tc)
+
+	c_cl := C.CString(cl)
+	defer C.free(unsafe.Pointer(c_cl))
+
+	c_tn := C.CString(tn)
+	defer C.free(unsafe.Pointer(c_tn))
+
+	c_bk := C.CString(bk)
+	defer C.free(unsafe.Pointer(c_bk))
+
+	c_obj := C.CString(obj)
+	defer C.free(unsafe.Pointer(c_obj))
+
+	var comp C.ccow_completion_t
+	ret = C.ccow_create_completion(tc, nil, nil, 1, &comp)
+	if ret != 0 {
+		return res, fmt.Errorf("%s: ccow_create_completion err=%d", GetFUNC(), ret)
+	}
+
+	var iov_name C.struct_iovec
+	iov_name.iov_base = unsafe.Pointer(c_pat)
+	iov_name.iov_len = C.strlen(c_pat) + 1
+
+	var iter C.ccow_lookup_t
+	ret = C.ccow_admin_pseudo_get(c_cl, C.strlen(c_cl)+1, c_tn, C.strlen(c_tn)+1,
+		c_bk, C.strlen(c_bk)+1, c_obj, C.strlen(c_obj)+1, &iov_name, 1, C.ulong(count), C.CCOW_GET_LIST,
+		comp, &iter)
+	if ret != 0 {
+		C.ccow_release(comp)
+		return res, fmt.Errorf("%s: ccow_admin_pseudo_get err=%d", GetFUNC(), ret)
+	}
+
+	ret = C.ccow_wait(comp, 0)
+	if ret == -C.ENOENT {
+		return res, nil
+	}
+	if ret != 0 {
+		return res, fmt.Errorf("%s: ccow_wait err=%d", GetFUNC(), ret)
+	}
+
+	defer C.ccow_lookup_release(iter)
+	var kv *C.struct_ccow_metadata_kv
+
+	for {
+		kv = (*C.struct_ccow_metadata_kv)(C.ccow_lookup_iter(iter,
+			C.CCOW_MDTYPE_NAME_INDEX, -1))
+
+		if kv == nil {
+			break
+		}
+		if kv.key_size == 0 {
+			continue
+		}
+
+		if strings.Compare(C.GoString(kv.key), pat) < cmp {
+			continue
+		}
+
+		e, ok, err := unpackObjectEntry(kv)
+		if err != nil {
+			return res, err
+		}
+		if ok {
+			res = append(res, e)
+		}
+	}
+
+	return res, nil
+}
+
+// ListObjects returns all live objects of a bucket whose names start with
+// prefix, fetching the name index in pages of 1000 entries.
+func ListObjects(cl string, tn string, bk string, prefix string) ([]ObjectEntry, error) {
+	var res []ObjectEntry
+	var last string = prefix
+	var cmp int = 0
+	for {
+		entries, err := GetObjectEntries(cl, tn, bk, "", last, cmp, 1000)
+		if err != nil {
+			return res, err
+		}
+		if len(entries) == 0 {
+			break
+		}
+		next := last
+		for _, e := range entries {
+			next = e.Name
+			if !strings.HasPrefix(e.Name, prefix) {
+				if e.Name > prefix {
+					return res, nil
+				}
+				continue
+			}
+			if e.Deleted {
+				continue
+			}
+			res = append(res, e)
+		}
+		if next <= last && cmp == 1 {
+			break
+		}
+		last = next
+		cmp = 1
+	}
+	return res, nil
+}
+
+// GetSnapshotEntry returns the version a snapshot of the snapview object
+// refers to, as recorded in the snapview entry
+func GetSnapshotEntry(cl string, tn string, bk string, obj string, name string) (ObjectEntry, error) {
+	var e ObjectEntry
+	conf, err := GetLibccowConf()
+	if err != nil {
+		return e, err
+	}
+
+	c_conf := C.CString(string(conf))
+	defer C.free(unsafe.Pointer(c_conf))
+
+	c_cl := C.CString(cl)
+	defer C.free(unsafe.Pointer(c_cl))
+
+	c_tn := C.CString(tn)
+	defer C.free(unsafe.Pointer(c_tn))
+
+	c_bk := C.CString(bk)
+	defer C.free(unsafe.Pointer(c_bk))
+
+	c_obj := C.CString(obj)
+	defer C.free(unsafe.Pointer(c_obj))
+
+	c_name := C.CString(name)
+	defer C.free(unsafe.Pointer(c_name))
+
+	var tc C.ccow_t
+	ret := C.ccow_tenant_init(c_conf, c_cl, C.strlen(c_cl)+1,
+		c_tn, C.strlen(c_tn)+1, &tc)
+	if ret != 0 {
+		return e, fmt.Errorf("%s: ccow_tenant_init err=%d", GetFUNC(), ret)
+	}
+	defer C.ccow_tenant_term(tc)
+
+	var sv C.ccow_snapview_t
+	ret = C.ccow_snapview_create(tc, &sv, c_bk, C.strlen(c_bk)+1, c_obj, C.strlen(c_obj)+1)
+	if ret != 0 && ret != -C.EEXIST {
+		return e, fmt.Errorf("%s: ccow_snapview_create err=%d", GetFUNC(), ret)
+	}
+	defer C.ccow_snapview_destroy(tc, sv)
+
+	var iter C.ccow_lookup_t
+	ret = C.ccow_snapshot_lookup(tc, sv, c_name, C.strlen(c_name)+1, 1, &iter)
+	if ret != 0 {
+		if iter != nil {
+			C.ccow_lookup_release(iter)
+		}
+		if ret == -C.ENOENT {
+			return e, fmt.Errorf("Snapshot '%s' not found", name)
+		}
+		return e, fmt.Errorf("%s: ccow_snapshot_lookup err=%d", GetFUNC(), ret)
+	}
+	defer C.ccow_lookup_release(iter)
+
+	var kv *C.struct_ccow_metadata_kv
+	for {
+		kv = (*C.struct_ccow_metadata_kv)(C.ccow_lookup_iter(iter,
+			C.CCOW_MDTYPE_NAME_INDEX, -1))
+		if kv == nil {
+			break
+		}
+		if kv.key_size == 0 || C.GoString(kv.key) != name {
+			continue
+		}
+
+		e, ok, err := unpackObjectEntry(kv)
+		if err != nil {
+			return e, err
+		}
+		if !ok {
+			return e, fmt.Errorf("Snapshot '%s' has an unknown entry format", name)
+		}
+		return e, nil
+	}
+
+	return e, fmt.Errorf("Snapshot '%s' not found", name)
+}
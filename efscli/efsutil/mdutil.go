@@ -140,6 +140,30 @@ func GetMDKey(cl string, tn string, bk string, obj string, key string) (string,
 	return "", fmt.Errorf("Key %s not found", key)
 }
 
+// GetBucketCustomMD returns custom attributes of the bucket, they are kept
+// on its name hash id pseudo object rather than on the bucket itself
+func GetBucketCustomMD(cl string, tn string, bk string) (map[string]string, error) {
+	nhid, err := GetMDKey(cl, tn, bk, "", "ccow-name-hash-id")
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]string)
+	md, err := GetMDPat(cl, tn, bk, nhid, "")
+	if err != nil {
+		if err.Error() == "Not found" {
+			return res, nil
+		}
+		return nil, err
+	}
+	for k, v := range md {
+		if !strings.HasPrefix(k, "ccow-") {
+			res[k] = v
+		}
+	}
+	return res, nil
+}
+
 func CheckService(svc string) bool {
 	name, err := GetMDKey("", "svcs", svc, "", "X-Service-Name")
 	if err != nil {
@@ -152,3 +176,181 @@ func CheckService(svc string) bool {
 
 	return true
 }
+
+// GetBuckets returns names of all buckets of the tenant
+func GetBuckets(cl string, tn string) ([]string, error) {
+	var res []string
+
+	conf, err := GetLibccowConf()
+	if err != nil {
+		return nil, err
+	}
+
+	c_conf := C.CString(string(conf))
+	defer C.free(unsafe.Pointer(c_conf))
+
+	c_cl := C.CString(cl)
+	defer C.free(unsafe.Pointer(c_cl))
+
+	c_tn := C.CString(tn)
+	defer C.free(unsafe.Pointer(c_tn))
+
+	var tc C.ccow_t
+
+	ret := C.ccow_tenant_init(c_conf, c_cl, C.strlen(c_cl)+1,
+		c_tn, C.strlen(c_tn)+1, &tc)
+	if ret != 0 {
+		return nil, fmt.Errorf("ccow_tenant_init err=%d", ret)
+	}
+	defer C.ccow_tenant_term(tc)
+
+	c_pat := C.CString("")
+	defer C.free(unsafe.Pointer(c_pat))
+
+	var iter C.ccow_lookup_t
+
+	ret = C.ccow_bucket_lookup(tc, c_pat, 1, 1000000, &iter)
+	if ret != 0 {
+		if iter != nil {
+			C.ccow_lookup_release(iter)
+		}
+		if ret == -C.ENOENT {
+			return res, nil
+		}
+		return nil, fmt.Errorf("bucket_lookup err=%d", ret)
+	}
+	defer C.ccow_lookup_release(iter)
+
+	var kv *C.struct_ccow_metadata_kv
+	for {
+		kv = (*C.struct_ccow_metadata_kv)(C.ccow_lookup_iter(iter, C.CCOW_MDTYPE_NAME_INDEX, -1))
+		if kv == nil {
+			break
+		}
+		if kv.key_size == 0 {
+			continue
+		}
+		name := C.GoString(kv.key)
+		if IsSystemName(name) {
+			continue
+		}
+		res = append(res, name)
+	}
+
+	return res, nil
+}
+
+// GetTenants returns names of all tenants of the cluster
+func GetTenants(cl string) ([]string, error) {
+	var res []string
+
+	conf, err := GetLibccowConf()
+	if err != nil {
+		return nil, err
+	}
+
+	c_conf := C.CString(string(conf))
+	defer C.free(unsafe.Pointer(c_conf))
+
+	c_cl := C.CString(cl)
+	defer C.free(unsafe.Pointer(c_cl))
+
+	var tc C.ccow_t
+
+	ret := C.ccow_admin_init(c_conf, c_cl, C.strlen(c_cl)+1, &tc)
+	if ret != 0 {
+		return nil, fmt.Errorf("ccow_admin_init err=%d", ret)
+	}
+	defer C.ccow_tenant_term(tc)
+
+	c_pat := C.CString("")
+	defer C.free(unsafe.Pointer(c_pat))
+
+	var iter C.ccow_lookup_t
+
+	ret = C.ccow_tenant_lookup(tc, nil, 0, c_pat, 1, 1000000, &iter)
+	if ret != 0 {
+		if iter != nil {
+			C.ccow_lookup_release(iter)
+		}
+		if ret == -C.ENOENT {
+			return res, nil
+		}
+		return nil, fmt.Errorf("ccow_tenant_lookup err=%d", ret)
+	}
+	defer C.ccow_lookup_release(iter)
+
+	var kv *C.struct_ccow_metadata_kv
+	for {
+		kv = (*C.struct_ccow_metadata_kv)(C.ccow_lookup_iter(iter, C.CCOW_MDTYPE_NAME_INDEX, -1))
+		if kv == nil {
+			break
+		}
+		if kv.key_size == 0 {
+			continue
+		}
+		name := C.GoString(kv.key)
+		if IsSystemName(name) {
+			continue
+		}
+		res = append(res, name)
+	}
+
+	return res, nil
+}
+
+// GetClusters returns names of all cluster namespaces
+func GetClusters() ([]string, error) {
+	var res []string
+
+	conf, err := GetLibccowConf()
+	if err != nil {
+		return nil, err
+	}
+
+	c_conf := C.CString(string(conf))
+	defer C.free(unsafe.Pointer(c_conf))
+
+	cl := C.CString("")
+	defer C.free(unsafe.Pointer(cl))
+
+	var tc C.ccow_t
+
+	ret := C.ccow_admin_init(c_conf, cl, 1, &tc)
+	if ret != 0 {
+		return nil, fmt.Errorf("ccow_admin_init err=%d", ret)
+	}
+	defer C.ccow_tenant_term(tc)
+
+	var iter C.ccow_lookup_t
+
+	ret = C.ccow_cluster_lookup(tc, cl, 1, 1000000, &iter)
+	if ret != 0 {
+		if iter != nil {
+			C.ccow_lookup_release(iter)
+		}
+		if ret == -C.ENOENT {
+			return res, nil
+		}
+		return nil, fmt.Errorf("ccow_cluster_lookup err=%d", ret)
+	}
+	defer C.ccow_lookup_release(iter)
+
+	var kv *C.struct_ccow_metadata_kv
+	for {
+		kv = (*C.struct_ccow_metadata_kv)(C.ccow_lookup_iter(iter, C.CCOW_MDTYPE_NAME_INDEX, -1))
+		if kv == nil {
+			break
+		}
+		if kv.key_size == 0 {
+			continue
+		}
+		name := C.GoString(kv.key)
+		if IsSystemName(name) {
+			continue
+		}
+		res = append(res, name)
+	}
+
+	return res, nil
+}
@@ -33,6 +33,7 @@ import "unsafe"
 
 import (
 	"fmt"
+	"strings"
 )
 
 func ObjectCreate(cl string, tn string, bk string, obj string) error {
@@ -181,3 +182,196 @@ func ObjectExpunge(cl string, tn string, bk string, obj string) error {
 
 	return nil
 }
+
+// ObjectPutData replaces payload of an object with data, it is meant for
+// small service objects like manifests and history records
+func ObjectPutData(cl string, tn string, bk string, obj string, data []byte) error {
+	c_cluster := C.CString(cl)
+	defer C.free(unsafe.Pointer(c_cluster))
+
+	c_tenant := C.CString(tn)
+	defer C.free(unsafe.Pointer(c_tenant))
+
+	c_bucket := C.CString(bk)
+	defer C.free(unsafe.Pointer(c_bucket))
+
+	c_object := C.CString(obj)
+	defer C.free(unsafe.Pointer(c_object))
+
+	conf, err := GetLibccowConf()
+	if err != nil {
+		return err
+	}
+
+	c_conf := C.CString(string(conf))
+	defer C.free(unsafe.Pointer(c_conf))
+
+	var tc C.ccow_t
+
+	ret := C.ccow_tenant_init(c_conf, c_cluster, C.strlen(c_cluster)+1,
+		c_tenant, C.strlen(c_tenant)+1, &tc)
+	if ret != 0 {
+		return fmt.Errorf("ccow_tenant_init err=%d", ret)
+	}
+	defer C.ccow_tenant_term(tc)
+
+	var c C.ccow_completion_t
+	var cont_flags C.int = C.CCOW_CONT_F_REPLACE
+	var genid C.uint64_t = 0
+	var io_count C.int = 0
+
+	var max_io_count C.int = 50000
+
+	ret = C.ccow_create_stream_completion(tc, nil, nil, max_io_count, &c,
+		c_bucket, C.strlen(c_bucket)+1, c_object, C.strlen(c_object)+1,
+		&genid, &cont_flags, nil)
+	if ret != 0 {
+		return fmt.Errorf("%s: ccow_create_stream_completion err=%d", GetFUNC(), ret)
+	}
+
+	chunk_size := uint64(C.ccow_chunk_size(c))
+	size := uint64(len(data))
+	if size/chunk_size+2 > uint64(max_io_count) {
+		C.ccow_cancel(c)
+		return fmt.Errorf("%s: object %s is too large", GetFUNC(), obj)
+	}
+
+	ret = C.ccow_put_cont(c, nil, 0, 0, 1, &io_count)
+	if ret != 0 {
+		C.ccow_cancel(c)
+		return fmt.Errorf("%s: ccow_put_cont err=%d", GetFUNC(), ret)
+	}
+
+	if size > 0 {
+		c_buf := C.CBytes(data)
+		defer C.free(c_buf)
+
+		var iov C.struct_iovec
+		for off := uint64(0); off < size; off += chunk_size {
+			n := chunk_size
+			if off+n > size {
+				n = size - off
+			}
+			iov.iov_base = unsafe.Pointer(uintptr(c_buf) + uintptr(off))
+			iov.iov_len = C.ulong(n)
+
+			ret = C.ccow_put_cont(c, &iov, 1, C.uint64_t(off), 1, &io_count)
+			if ret != 0 {
+				C.ccow_cancel(c)
+				return fmt.Errorf("%s: ccow_put_cont err=%d", GetFUNC(), ret)
+			}
+
+			ret = C.ccow_wait(c, io_count)
+			if ret != 0 {
+				C.ccow_cancel(c)
+				return fmt.Errorf("%s: ccow_wait err=%d", GetFUNC(), ret)
+			}
+		}
+	}
+
+	ret = C.ccow_finalize(c, nil)
+	if ret != 0 {
+		return fmt.Errorf("%s: ccow_finalize err=%d", GetFUNC(), ret)
+	}
+
+	return nil
+}
+
+// ObjectGetData returns payload of the latest version of an object
+func ObjectGetData(cl string, tn string, bk string, obj string) ([]byte, error) {
+	c_cluster := C.CString(cl)
+	defer C.free(unsafe.Pointer(c_cluster))
+
+	c_tenant := C.CString(tn)
+	defer C.free(unsafe.Pointer(c_tenant))
+
+	c_bucket := C.CString(bk)
+	defer C.free(unsafe.Pointer(c_bucket))
+
+	c_object := C.CString(obj)
+	defer C.free(unsafe.Pointer(c_object))
+
+	conf, err := GetLibccowConf()
+	if err != nil {
+		return nil, err
+	}
+
+	c_conf := C.CString(string(conf))
+	defer C.free(unsafe.Pointer(c_conf))
+
+	var tc C.ccow_t
+
+	ret := C.ccow_tenant_init(c_conf, c_cluster, C.strlen(c_cluster)+1,
+		c_tenant, C.strlen(c_tenant)+1, &tc)
+	if ret != 0 {
+		return nil, fmt.Errorf("ccow_tenant_init err=%d", ret)
+	}
+	defer C.ccow_tenant_term(tc)
+
+	var c C.ccow_completion_t
+	var cont_flags C.int = 0
+	var genid C.uint64_t = 0
+	var io_count C.int = 0
+	var iter C.ccow_lookup_t
+
+	ret = C.ccow_create_stream_completion(tc, nil, nil, 50000, &c,
+		c_bucket, C.strlen(c_bucket)+1, c_object, C.strlen(c_object)+1,
+		&genid, &cont_flags, &iter)
+	if ret != 0 {
+		return nil, fmt.Errorf("%s: ccow_create_stream_completion err=%d", GetFUNC(), ret)
+	}
+	defer C.ccow_cancel(c)
+
+	if cont_flags != C.CCOW_CONT_F_EXIST {
+		return nil, fmt.Errorf("Not found")
+	}
+
+	chunk_size := uint64(C.ccow_chunk_size(c))
+	var size uint64 = 0
+
+	var kv *C.struct_ccow_metadata_kv
+	for {
+		kv = (*C.struct_ccow_metadata_kv)(C.ccow_lookup_iter(iter,
+			C.CCOW_MDTYPE_METADATA, -1))
+		if kv == nil {
+			break
+		}
+		if strings.Compare(C.GoString(kv.key), C.RT_SYSKEY_LOGICAL_SIZE) == 0 {
+			size = uint64(*(*C.ulong)(kv.value))
+			continue
+		}
+		if strings.Compare(C.GoString(kv.key), C.RT_SYSKEY_CHUNKMAP_CHUNK_SIZE) == 0 {
+			chunk_size = uint64(*(*C.ulong)(kv.value))
+			continue
+		}
+	}
+
+	if size == 0 {
+		return []byte{}, nil
+	}
+
+	c_buf := C.malloc(C.ulong(size))
+	defer C.free(c_buf)
+
+	var iov C.struct_iovec
+	for off := uint64(0); off < size; off += chunk_size {
+		n := chunk_size
+		if off+n > size {
+			n = size - off
+		}
+		iov.iov_base = unsafe.Pointer(uintptr(c_buf) + uintptr(off))
+		iov.iov_len = C.ulong(n)
+
+		ret = C.ccow_get_cont(c, &iov, 1, C.uint64_t(off), 1, &io_count)
+		if ret != 0 {
+			return nil, fmt.Errorf("%s: ccow_get_cont err=%d", GetFUNC(), ret)
+		}
+
+		ret = C.ccow_wait(c, io_count)
+		if ret != 0 {
+			return nil, fmt.Errorf("%s: ccow_wait err=%d", GetFUNC(), ret)
+		}
+	}
+
+	return C.GoBytes(c_buf, C.int(size)), nil
+}
@@ -0,0 +1,312 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package efsutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// S3 compatible bucket policy documents and their evaluation. Only the
+// principal, action and resource elements are evaluated, documents with
+// conditions are rejected by Validate.
+
+const (
+	PolicyEffectAllow = "Allow"
+	PolicyEffectDeny  = "Deny"
+
+	policyArnPrefix = "arn:aws:s3:::"
+)
+
+// PolicyValues is a policy element which may be a string or a list
+type PolicyValues []string
+
+func (v *PolicyValues) UnmarshalJSON(data []byte) error {
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		*v = PolicyValues{s}
+		return nil
+	}
+	var l []string
+	err := json.Unmarshal(data, &l)
+	if err != nil {
+		return fmt.Errorf("expecting a string or a list of strings")
+	}
+	*v = l
+	return nil
+}
+
+// PolicyPrincipal is either "*" or {"AWS": ...}
+type PolicyPrincipal struct {
+	Any bool
+	AWS PolicyValues
+}
+
+func (p *PolicyPrincipal) UnmarshalJSON(data []byte) error {
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		if s != "*" {
+			return fmt.Errorf("principal string has to be \"*\"")
+		}
+		p.Any = true
+		return nil
+	}
+	var m map[string]PolicyValues
+	err := json.Unmarshal(data, &m)
+	if err != nil {
+		return err
+	}
+	for k, v := range m {
+		if k != "AWS" {
+			return fmt.Errorf("unsupported principal type %s", k)
+		}
+		p.AWS = v
+	}
+	return nil
+}
+
+func (p PolicyPrincipal) MarshalJSON() ([]byte, error) {
+	if p.Any {
+		return json.Marshal("*")
+	}
+	return json.Marshal(map[string]PolicyValues{"AWS": p.AWS})
+}
+
+type PolicyStatement struct {
+	Sid         string                 `json:"Sid,omitempty"`
+	Effect      string                 `json:"Effect"`
+	Principal   *PolicyPrincipal       `json:"Principal,omitempty"`
+	Action      PolicyValues           `json:"Action,omitempty"`
+	NotAction   PolicyValues           `json:"NotAction,omitempty"`
+	Resource    PolicyValues           `json:"Resource,omitempty"`
+	NotResource PolicyValues           `json:"NotResource,omitempty"`
+	Condition   map[string]interface{} `json:"Condition,omitempty"`
+}
+
+type Policy struct {
+	Version   string            `json:"Version"`
+	Id        string            `json:"Id,omitempty"`
+	Statement []PolicyStatement `json:"Statement"`
+}
+
+// PolicyRequest is the request a policy is evaluated for
+type PolicyRequest struct {
+	User     string
+	Action   string
+	Resource string
+}
+
+// PolicyDecision is the evaluation result, Matched lists the statements
+// which apply to the request in document order
+type PolicyDecision struct {
+	Allowed  bool
+	Explicit bool
+	Matched  []int
+	Reason   string
+}
+
+func ParsePolicy(data []byte) (*Policy, error) {
+	p := new(Policy)
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(p)
+	if err != nil {
+		return nil, fmt.Errorf("Policy parse error: %v", err)
+	}
+	return p, nil
+}
+
+// PolicyResource returns the ARN of a bucket or of a key in it
+func PolicyResource(bucket string, key string) string {
+	if key == "" {
+		return policyArnPrefix + bucket
+	}
+	return policyArnPrefix + bucket + "/" + key
+}
+
+func (st *PolicyStatement) label(i int) string {
+	if st.Sid != "" {
+		return fmt.Sprintf("statement %d (%s)", i, st.Sid)
+	}
+	return fmt.Sprintf("statement %d", i)
+}
+
+// Validate checks the document structure and that every resource belongs
+// to the bucket
+func (p *Policy) Validate(bucket string) []error {
+	var errs []error
+
+	if p.Version != "2012-10-17" && p.Version != "2008-10-17" {
+		errs = append(errs, fmt.Errorf("Version has to be 2012-10-17 or 2008-10-17"))
+	}
+	if len(p.Statement) == 0 {
+		errs = append(errs, fmt.Errorf("Statement list is empty"))
+	}
+
+	for i, st := range p.Statement {
+		l := st.label(i)
+		if st.Effect != PolicyEffectAllow && st.Effect != PolicyEffectDeny {
+			errs = append(errs, fmt.Errorf("%s: Effect has to be Allow or Deny", l))
+		}
+		if st.Principal == nil || (!st.Principal.Any && len(st.Principal.AWS) == 0) {
+			errs = append(errs, fmt.Errorf("%s: Principal is missing", l))
+		}
+		if (len(st.Action) == 0) == (len(st.NotAction) == 0) {
+			errs = append(errs, fmt.Errorf("%s: exactly one of Action or NotAction is required", l))
+		}
+		if (len(st.Resource) == 0) == (len(st.NotResource) == 0) {
+			errs = append(errs, fmt.Errorf("%s: exactly one of Resource or NotResource is required", l))
+		}
+		if len(st.Condition) > 0 {
+			errs = append(errs, fmt.Errorf("%s: Condition is not supported", l))
+		}
+		for _, a := range append(st.Action, st.NotAction...) {
+			if a != "*" && !strings.HasPrefix(a, "s3:") {
+				errs = append(errs, fmt.Errorf("%s: action %s is not an s3 action", l, a))
+			}
+		}
+		for _, r := range append(st.Resource, st.NotResource...) {
+			if r == "*" {
+				continue
+			}
+			if !strings.HasPrefix(r, policyArnPrefix) {
+				errs = append(errs, fmt.Errorf("%s: resource %s is not an s3 ARN", l, r))
+				continue
+			}
+			b := strings.SplitN(strings.TrimPrefix(r, policyArnPrefix), "/", 2)[0]
+			if bucket != "" && !WildcardMatch(b, bucket) {
+				errs = append(errs, fmt.Errorf("%s: resource %s does not belong to bucket %s", l, r, bucket))
+			}
+		}
+	}
+	return errs
+}
+
+// WildcardMatch matches s against a pattern with * and ? wildcards, unlike
+// path.Match the wildcards also match /
+func WildcardMatch(pattern string, s string) bool {
+	// On a mismatch after a star the star absorbs one more byte and the
+	// match resumes, only the last star needs to be remembered
+	p, i := 0, 0
+	star, mark := -1, 0
+	for i < len(s) {
+		if p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]) {
+			p++
+			i++
+		} else if p < len(pattern) && pattern[p] == '*' {
+			star = p
+			mark = i
+			p++
+		} else if star >= 0 {
+			mark++
+			i = mark
+			p = star + 1
+		} else {
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+func matchAny(patterns PolicyValues, s string, fold bool) bool {
+	for _, p := range patterns {
+		if fold && WildcardMatch(strings.ToLower(p), strings.ToLower(s)) {
+			return true
+		}
+		if !fold && WildcardMatch(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (st *PolicyStatement) matchPrincipal(user string) bool {
+	if st.Principal == nil {
+		return false
+	}
+	if st.Principal.Any {
+		return true
+	}
+	for _, p := range st.Principal.AWS {
+		if p == "*" || p == user || strings.HasSuffix(p, ":user/"+user) {
+			return true
+		}
+	}
+	return false
+}
+
+// Applies reports whether the statement covers the request
+func (st *PolicyStatement) Applies(req PolicyRequest) bool {
+	if !st.matchPrincipal(req.User) {
+		return false
+	}
+	// action names are case insensitive, resources are not
+	if len(st.Action) > 0 && !matchAny(st.Action, req.Action, true) {
+		return false
+	}
+	if len(st.NotAction) > 0 && matchAny(st.NotAction, req.Action, true) {
+		return false
+	}
+	if len(st.Resource) > 0 && !matchAny(st.Resource, req.Resource, false) {
+		return false
+	}
+	if len(st.NotResource) > 0 && matchAny(st.NotResource, req.Resource, false) {
+		return false
+	}
+	return true
+}
+
+// Evaluate follows S3 semantics: an explicit deny wins, otherwise an allow
+// is required, otherwise the request is implicitly denied
+func (p *Policy) Evaluate(req PolicyRequest) PolicyDecision {
+	var d PolicyDecision
+	var allow, deny []int
+
+	for i := range p.Statement {
+		if p.Statement[i].Applies(req) {
+			d.Matched = append(d.Matched, i)
+			if p.Statement[i].Effect == PolicyEffectDeny {
+				deny = append(deny, i)
+			} else {
+				allow = append(allow, i)
+			}
+		}
+	}
+
+	if len(deny) > 0 {
+		d.Explicit = true
+		d.Reason = "explicitly denied by " + p.Statement[deny[0]].label(deny[0])
+	} else if len(allow) > 0 {
+		d.Allowed = true
+		d.Explicit = true
+		d.Reason = "allowed by " + p.Statement[allow[0]].label(allow[0])
+	} else {
+		d.Reason = "implicitly denied, no statement applies"
+	}
+	return d
+}
@@ -0,0 +1,218 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package efsutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWildcardMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"*", "", true},
+		{"*", "a/b/c", true},
+		{"?", "", false},
+		{"?", "a", true},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"a*b", "ab", true},
+		{"a*b", "axxb", true},
+		{"a*b", "axxbc", false},
+		{"*a*b*", "xxaybz", true},
+		{"*ab", "aab", true},
+		{"*aab", "aaab", true},
+		{"a*b*c", "abxbxc", true},
+		{"a*b*c", "abxbx", false},
+		{"**", "x", true},
+		{"arn:aws:s3:::bk/*", "arn:aws:s3:::bk/x/y", true},
+		{"arn:aws:s3:::bk/*", "arn:aws:s3:::bk2/x", false},
+		{strings.Repeat("*a", 30) + "b", strings.Repeat("a", 100), false},
+	}
+
+	for _, tt := range tests {
+		got := WildcardMatch(tt.pattern, tt.s)
+		if got != tt.want {
+			t.Errorf("WildcardMatch(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+const testPolicy = `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Sid": "read",
+      "Effect": "Allow",
+      "Principal": "*",
+      "Action": ["s3:GetObject", "s3:ListBucket"],
+      "Resource": ["arn:aws:s3:::bk", "arn:aws:s3:::bk/*"]
+    },
+    {
+      "Sid": "writer",
+      "Effect": "Allow",
+      "Principal": {"AWS": "arn:aws:iam::123:user/alice"},
+      "NotAction": "s3:DeleteObject",
+      "Resource": "arn:aws:s3:::bk/*"
+    },
+    {
+      "Sid": "private",
+      "Effect": "Deny",
+      "Principal": "*",
+      "Action": "s3:*",
+      "Resource": "arn:aws:s3:::bk/private/*"
+    },
+    {
+      "Sid": "nopublic",
+      "Effect": "Deny",
+      "Principal": {"AWS": "bob"},
+      "Action": "s3:*",
+      "NotResource": "arn:aws:s3:::bk/public/*"
+    }
+  ]
+}`
+
+func TestPolicyEvaluate(t *testing.T) {
+	p, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := p.Validate("bk"); len(errs) > 0 {
+		t.Fatalf("unexpected validation errors %v", errs)
+	}
+
+	tests := []struct {
+		name     string
+		user     string
+		action   string
+		key      string
+		allowed  bool
+		explicit bool
+	}{
+		{"public read", "carol", "s3:GetObject", "a", true, true},
+		{"case insensitive action", "carol", "S3:getobject", "a", true, true},
+		{"bucket listing", "carol", "s3:ListBucket", "", true, true},
+		{"implicit deny", "carol", "s3:PutObject", "a", false, false},
+		{"not action allows", "alice", "s3:PutObject", "a", true, true},
+		{"not action excludes", "alice", "s3:DeleteObject", "a", false, false},
+		{"deny beats allow", "alice", "s3:GetObject", "private/a", false, true},
+		{"deny beats not action allow", "alice", "s3:PutObject", "private/a", false, true},
+		{"not resource denies", "bob", "s3:GetObject", "a", false, true},
+		{"not resource excludes", "bob", "s3:GetObject", "public/a", true, true},
+		{"resources are case sensitive", "carol", "s3:GetObject", "Private/a", true, true},
+	}
+
+	for _, tt := range tests {
+		req := PolicyRequest{User: tt.user, Action: tt.action, Resource: PolicyResource("bk", tt.key)}
+		d := p.Evaluate(req)
+		if d.Allowed != tt.allowed || d.Explicit != tt.explicit {
+			t.Errorf("%s: got allowed=%v explicit=%v (%s), want allowed=%v explicit=%v",
+				tt.name, d.Allowed, d.Explicit, d.Reason, tt.allowed, tt.explicit)
+		}
+	}
+}
+
+func TestPolicyStatementApplies(t *testing.T) {
+	st := PolicyStatement{
+		Effect:    PolicyEffectAllow,
+		Principal: &PolicyPrincipal{AWS: PolicyValues{"alice"}},
+		Action:    PolicyValues{"s3:Get*"},
+		Resource:  PolicyValues{"arn:aws:s3:::bk/*"},
+	}
+
+	tests := []struct {
+		req  PolicyRequest
+		want bool
+	}{
+		{PolicyRequest{"alice", "s3:GetObject", "arn:aws:s3:::bk/a"}, true},
+		{PolicyRequest{"alice", "S3:GETOBJECTACL", "arn:aws:s3:::bk/a"}, true},
+		{PolicyRequest{"bob", "s3:GetObject", "arn:aws:s3:::bk/a"}, false},
+		{PolicyRequest{"alice", "s3:PutObject", "arn:aws:s3:::bk/a"}, false},
+		{PolicyRequest{"alice", "s3:GetObject", "arn:aws:s3:::bk"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := st.Applies(tt.req); got != tt.want {
+			t.Errorf("Applies(%+v) = %v, want %v", tt.req, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		errs   int
+	}{
+		{"valid", `{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Principal": "*",
+			"Action": "s3:GetObject", "Resource": "arn:aws:s3:::bk/*"}]}`, 0},
+		{"condition", `{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Principal": "*",
+			"Action": "s3:GetObject", "Resource": "arn:aws:s3:::bk/*",
+			"Condition": {"IpAddress": {"aws:SourceIp": "10.0.0.0/8"}}}]}`, 1},
+		{"bad version", `{"Version": "2020-01-01", "Statement": [{"Effect": "Allow", "Principal": "*",
+			"Action": "s3:GetObject", "Resource": "arn:aws:s3:::bk/*"}]}`, 1},
+		{"no statements", `{"Version": "2012-10-17", "Statement": []}`, 1},
+		{"bad effect", `{"Version": "2012-10-17", "Statement": [{"Effect": "Maybe", "Principal": "*",
+			"Action": "s3:GetObject", "Resource": "arn:aws:s3:::bk/*"}]}`, 1},
+		{"no principal", `{"Version": "2012-10-17", "Statement": [{"Effect": "Allow",
+			"Action": "s3:GetObject", "Resource": "arn:aws:s3:::bk/*"}]}`, 1},
+		{"action and not action", `{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Principal": "*",
+			"Action": "s3:GetObject", "NotAction": "s3:PutObject", "Resource": "arn:aws:s3:::bk/*"}]}`, 1},
+		{"no resource", `{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Principal": "*",
+			"Action": "s3:GetObject"}]}`, 1},
+		{"non s3 action", `{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Principal": "*",
+			"Action": "iam:GetUser", "Resource": "arn:aws:s3:::bk/*"}]}`, 1},
+		{"other bucket", `{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Principal": "*",
+			"Action": "s3:GetObject", "Resource": "arn:aws:s3:::other/*"}]}`, 1},
+	}
+
+	for _, tt := range tests {
+		p, err := ParsePolicy([]byte(tt.policy))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if errs := p.Validate("bk"); len(errs) != tt.errs {
+			t.Errorf("%s: got %d error(s) %v, want %d", tt.name, len(errs), errs, tt.errs)
+		}
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	for _, s := range []string{
+		`{"Version": "2012-10-17", "Statement": [], "Unknown": 1}`,
+		`{"Version": "2012-10-17", "Statement": [{"Principal": "alice"}]}`,
+		`{"Version": "2012-10-17", "Statement": [{"Principal": {"Service": "x"}}]}`,
+		`{"Version": "2012-10-17", "Statement": [{"Action": 1}]}`,
+	} {
+		if _, err := ParsePolicy([]byte(s)); err == nil {
+			t.Errorf("ParsePolicy(%s) succeeded, want an error", s)
+		}
+	}
+}
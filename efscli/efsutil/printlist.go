@@ -418,3 +418,7 @@ func PrintKeys(cl string, tn string, bk string, obj string, count int) error {
 
 	return nil
 }
+
+func OndemandPolicyNames() []string {
+	return ondemandPolicyName[:]
+}
@@ -34,6 +34,7 @@ import "unsafe"
 import (
 	"fmt"
 	"bytes"
+	"sort"
 	"strings"
 )
 
@@ -476,3 +477,31 @@ func GetMDPat(cl string, tn string, bk string, obj string, pat string) (map[stri
 }
 
 
+
+// PrintMDDiff prints keys whose values differ between two metadata snapshots
+func PrintMDDiff(before map[string]string, after map[string]string) int {
+	keys := make([]string, 0)
+	for k, v := range after {
+		if before[k] != v {
+			keys = append(keys, k)
+		}
+	}
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		b, a := before[k], after[k]
+		if b == "" {
+			b = "-"
+		}
+		if a == "" {
+			a = "-"
+		}
+		fmt.Printf("%-40s %s -> %s\n", k, b, a)
+	}
+	return len(keys)
+}
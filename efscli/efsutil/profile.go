@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package efsutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Attribute profiles are named sets of create flags. They are kept as
+// X-Profile-<name> keys of the svcs tenant, values are JSON maps of flag
+// name to value.
+const ProfileKeyPrefix = "X-Profile-"
+
+type Profile map[string]string
+
+func (p Profile) String() string {
+	var keys []string
+	for k := range p {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var res []string
+	for _, k := range keys {
+		res = append(res, "--"+k+" "+p[k])
+	}
+	return strings.Join(res, " ")
+}
+
+func SaveProfile(name string, p Profile) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return UpdateMD("", "svcs", "", "", ProfileKeyPrefix+name, string(data))
+}
+
+func LoadProfile(name string) (Profile, error) {
+	v, err := GetMDKey("", "svcs", "", "", ProfileKeyPrefix+name)
+	if err != nil {
+		return nil, fmt.Errorf("Profile %s not found", name)
+	}
+
+	p := make(Profile)
+	err = json.Unmarshal([]byte(v), &p)
+	if err != nil {
+		return nil, fmt.Errorf("Profile %s decoding error: %v", name, err)
+	}
+	return p, nil
+}
+
+func GetProfiles() (map[string]Profile, error) {
+	md, err := GetMDPat("", "svcs", "", "", ProfileKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]Profile)
+	for k, v := range md {
+		p := make(Profile)
+		if json.Unmarshal([]byte(v), &p) != nil {
+			continue
+		}
+		res[strings.TrimPrefix(k, ProfileKeyPrefix)] = p
+	}
+	return res, nil
+}
+
+func DeleteProfile(name string) error {
+	_, err := LoadProfile(name)
+	if err != nil {
+		return err
+	}
+	return UpdateMDMany("", "svcs", "", "", []KeyValue{{Key: ProfileKeyPrefix + name, Value: ""}})
+}
+
+// ApplyProfile fills flags of the command from the profile, values given
+// explicitly on the command line take precedence. Attributes the command
+// does not have, e.g. quota for tenants, are skipped with a warning.
+func ApplyProfile(cmd *cobra.Command, flagNames []string, flags []FlagValue, name string) error {
+	p, err := LoadProfile(name)
+	if err != nil {
+		return err
+	}
+
+	for k := range p {
+		found := false
+		for _, n := range flagNames {
+			if n == k {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fmt.Printf("Warning: profile %s attribute %s ignored by %s\n", name, k, cmd.CommandPath())
+		}
+	}
+
+	for i := 0; i < len(flagNames); i++ {
+		v, ok := p[flagNames[i]]
+		if !ok || cmd.Flags().Changed(flagNames[i]) {
+			continue
+		}
+		flags[i].Value = v
+	}
+	return nil
+}
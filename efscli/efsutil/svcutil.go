@@ -0,0 +1,259 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package efsutil
+
+/*
+#include "ccow.h"
+#include "errno.h"
+*/
+import "C"
+import "unsafe"
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IsServiceCompanion tells whether a bucket of svcs holds stats or config
+// history of a service rather than being a service itself
+func IsServiceCompanion(name string) bool {
+	return strings.HasSuffix(name, ".stat") || strings.HasSuffix(name, ".history")
+}
+
+// GetServices returns names of all services defined in the system
+func GetServices() ([]string, error) {
+	var res []string
+
+	conf, err := GetLibccowConf()
+	if err != nil {
+		return nil, err
+	}
+
+	c_conf := C.CString(string(conf))
+	defer C.free(unsafe.Pointer(c_conf))
+
+	cl := C.CString("")
+	defer C.free(unsafe.Pointer(cl))
+
+	var tc C.ccow_t
+
+	ret := C.ccow_admin_init(c_conf, cl, 1, &tc)
+	if ret != 0 {
+		return nil, fmt.Errorf("ccow_admin_init err=%d", ret)
+	}
+	defer C.ccow_tenant_term(tc)
+
+	var iter C.ccow_lookup_t
+
+	ret = C.ccow_bucket_lookup(tc, cl, 1, 10000, &iter)
+	if ret != 0 {
+		if iter != nil {
+			C.ccow_lookup_release(iter)
+		}
+		if ret == -C.ENOENT {
+			return res, nil
+		}
+		return nil, fmt.Errorf("%s: service_lookup err=%d", GetFUNC(), ret)
+	}
+	defer C.ccow_lookup_release(iter)
+
+	var kv *C.struct_ccow_metadata_kv
+	for {
+		kv = (*C.struct_ccow_metadata_kv)(C.ccow_lookup_iter(iter, C.CCOW_MDTYPE_NAME_INDEX, -1))
+		if kv == nil {
+			break
+		}
+		if kv.key_size == 0 {
+			continue
+		}
+		name := C.GoString(kv.key)
+		if IsSystemName(name) || IsServiceCompanion(name) {
+			continue
+		}
+		res = append(res, name)
+	}
+
+	return res, nil
+}
+
+// ServiceEntry is an export, LUN or tenant served by a service
+type ServiceEntry struct {
+	Service string
+	Type    string
+	Status  string
+	Entry   string
+}
+
+// ServiceObjectPath returns cluster/tenant/bucket[/object] part of a
+// service entry, stripping the id prefix of NFS and iSCSI entries and
+// the options of ISGW ones
+func ServiceObjectPath(svcType string, entry string) string {
+	switch svcType {
+	case "nfs", "iscsi":
+		if i := strings.Index(entry, "@"); i >= 0 {
+			return entry[i+1:]
+		}
+	case "isgw":
+		return strings.Split(entry, ",")[0]
+	}
+	return entry
+}
+
+// GetServiceEntries lists entries of every service, optionally limited
+// to a single service type
+func GetServiceEntries(svcType string) ([]ServiceEntry, error) {
+	var res []ServiceEntry
+
+	services, err := GetServices()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, svc := range services {
+		md, err := GetMDPat("", "svcs", svc, "", "X-")
+		if err != nil {
+			return nil, fmt.Errorf("Service %s: %v", svc, err)
+		}
+		if svcType != "" && md["X-Service-Type"] != svcType {
+			continue
+		}
+
+		entries, err := ListKeys("", "svcs", svc, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			res = append(res, ServiceEntry{
+				Service: svc,
+				Type:    md["X-Service-Type"],
+				Status:  md["X-Status"],
+				Entry:   e,
+			})
+		}
+	}
+
+	return res, nil
+}
+
+// InsertServiceEntry adds an entry to the service as it is, e.g. with the
+// export or LUN id already assigned
+func InsertServiceEntry(svc string, entry string) error {
+	conf, err := GetLibccowConf()
+	if err != nil {
+		return err
+	}
+
+	c_conf := C.CString(string(conf))
+	defer C.free(unsafe.Pointer(c_conf))
+
+	cl := C.CString("")
+	defer C.free(unsafe.Pointer(cl))
+
+	c_service := C.CString(svc)
+	defer C.free(unsafe.Pointer(c_service))
+
+	c_entry := C.CString(entry)
+	defer C.free(unsafe.Pointer(c_entry))
+
+	var tc C.ccow_t
+
+	ret := C.ccow_admin_init(c_conf, cl, 1, &tc)
+	if ret != 0 {
+		return fmt.Errorf("ccow_admin_init err=%d", ret)
+	}
+	defer C.ccow_tenant_term(tc)
+
+	var comp C.ccow_completion_t
+	ret = C.ccow_create_completion(tc, nil, nil, 1, &comp)
+	if ret != 0 {
+		return fmt.Errorf("%s: ccow_create_completion err=%d", GetFUNC(), ret)
+	}
+
+	var iov_name C.struct_iovec
+	iov_name.iov_base = unsafe.Pointer(c_entry)
+	iov_name.iov_len = C.strlen(c_entry) + 1
+	ret = C.ccow_insert_list(c_service, C.strlen(c_service)+1, cl, 1, comp, &iov_name, 1)
+	if ret != 0 {
+		C.ccow_release(comp)
+		return fmt.Errorf("%s: ccow_insert_list err=%d", GetFUNC(), ret)
+	}
+
+	ret = C.ccow_wait(comp, 0)
+	if ret != 0 {
+		return fmt.Errorf("%s: ccow_wait err=%d", GetFUNC(), ret)
+	}
+
+	return nil
+}
+
+// RemoveServiceEntry drops an entry from the service without any type
+// specific cleanup
+func RemoveServiceEntry(svc string, entry string) error {
+	conf, err := GetLibccowConf()
+	if err != nil {
+		return err
+	}
+
+	c_conf := C.CString(string(conf))
+	defer C.free(unsafe.Pointer(c_conf))
+
+	cl := C.CString("")
+	defer C.free(unsafe.Pointer(cl))
+
+	c_service := C.CString(svc)
+	defer C.free(unsafe.Pointer(c_service))
+
+	c_entry := C.CString(entry)
+	defer C.free(unsafe.Pointer(c_entry))
+
+	var tc C.ccow_t
+
+	ret := C.ccow_admin_init(c_conf, cl, 1, &tc)
+	if ret != 0 {
+		return fmt.Errorf("ccow_admin_init err=%d", ret)
+	}
+	defer C.ccow_tenant_term(tc)
+
+	var comp C.ccow_completion_t
+	ret = C.ccow_create_completion(tc, nil, nil, 1, &comp)
+	if ret != 0 {
+		return fmt.Errorf("%s: ccow_create_completion err=%d", GetFUNC(), ret)
+	}
+
+	var iov_name C.struct_iovec
+	iov_name.iov_base = unsafe.Pointer(c_entry)
+	iov_name.iov_len = C.strlen(c_entry) + 1
+	ret = C.ccow_delete_list(c_service, C.strlen(c_service)+1, cl, 1, comp, &iov_name, 1)
+	if ret != 0 {
+		C.ccow_release(comp)
+		return fmt.Errorf("%s: ccow_delete_list err=%d", GetFUNC(), ret)
+	}
+
+	ret = C.ccow_wait(comp, 0)
+	if ret != 0 {
+		return fmt.Errorf("%s: ccow_wait err=%d", GetFUNC(), ret)
+	}
+
+	return nil
+}
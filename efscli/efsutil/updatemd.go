@@ -263,6 +263,92 @@ func UpdateMDMany(cl string, tn string, bk string, obj string, par []KeyValue) e
 	return nil
 }
 
+// UpdateDefaultAttributes rewrites default attributes of an existing
+// tenant, bucket or object, custom attributes are handled separately
+func UpdateDefaultAttributes(cl string, tn string, bk string, obj string, flags []FlagValue) error {
+	conf, err := GetLibccowConf()
+	if err != nil {
+		return err
+	}
+
+	c_conf := C.CString(string(conf))
+	defer C.free(unsafe.Pointer(c_conf))
+
+	clempty := C.CString("")
+	defer C.free(unsafe.Pointer(clempty))
+
+	var tc C.ccow_t
+
+	ret := C.ccow_admin_init(c_conf, clempty, 1, &tc)
+	if ret != 0 {
+		return fmt.Errorf("ccow_admin_init err=%d", ret)
+	}
+	defer C.ccow_tenant_term(tc)
+
+	c_cl := C.CString(cl)
+	defer C.free(unsafe.Pointer(c_cl))
+
+	c_tn := C.CString(tn)
+	defer C.free(unsafe.Pointer(c_tn))
+
+	c_bk := C.CString(bk)
+	defer C.free(unsafe.Pointer(c_bk))
+
+	c_obj := C.CString(obj)
+	defer C.free(unsafe.Pointer(c_obj))
+
+	ret = C.ccow_range_lock(tc, c_bk, C.strlen(c_bk)+1, c_obj,
+		C.strlen(c_obj)+1, 0, 1, C.CCOW_LOCK_EXCL)
+	if ret != 0 {
+		return fmt.Errorf("%s: ccow_range_lock err=%d", GetFUNC(), ret)
+	}
+
+	defer C.ccow_range_lock(tc, c_bk, C.strlen(c_bk)+1, c_obj,
+		C.strlen(c_obj)+1, 0, 1, C.CCOW_LOCK_UNLOCK)
+
+	var comp C.ccow_completion_t
+	ret = C.ccow_create_completion(tc, nil, nil, 2, &comp)
+	if ret != 0 {
+		return fmt.Errorf("%s: ccow_create_completion err=%d", GetFUNC(), ret)
+	}
+
+	var iter C.ccow_lookup_t
+	ret = C.ccow_admin_pseudo_get(c_cl, C.strlen(c_cl)+1, c_tn, C.strlen(c_tn)+1,
+		c_bk, C.strlen(c_bk)+1, c_obj, C.strlen(c_obj)+1, nil, 0, 0, C.CCOW_GET,
+		comp, &iter)
+	if ret != 0 {
+		C.ccow_release(comp)
+		return fmt.Errorf("%s: ccow_admin_pseudo_get err=%d", GetFUNC(), ret)
+	}
+
+	ret = C.ccow_wait(comp, 0)
+	if ret != 0 {
+		return fmt.Errorf("%s: ccow_wait err=%d", GetFUNC(), ret)
+	}
+	defer C.ccow_lookup_release(iter)
+
+	err = ModifyDefaultAttributes(unsafe.Pointer(comp), flags)
+	if err != nil {
+		C.ccow_release(comp)
+		return err
+	}
+
+	ret = C.ccow_admin_pseudo_put(c_cl, C.strlen(c_cl)+1, c_tn, C.strlen(c_tn)+1,
+		c_bk, C.strlen(c_bk)+1, c_obj, C.strlen(c_obj)+1, nil,
+		0, 0, C.CCOW_PUT, nil, comp)
+	if ret != 0 {
+		C.ccow_release(comp)
+		return fmt.Errorf("%s: ccow_admin_pseudo_put err=%d", GetFUNC(), ret)
+	}
+
+	ret = C.ccow_wait(comp, 1)
+	if ret != 0 {
+		return fmt.Errorf("%s: ccow_wait err=%d", GetFUNC(), ret)
+	}
+
+	return nil
+}
+
 // Service calls this function after it is certain that it is up
 // and running, so that we can update service metadata with dynamic info
 func K8sServiceUp(sname string) error {
@@ -307,7 +307,10 @@ func DeleteUser(cluster string, tenant string, user *User) error {
 	return nil
 }
 
-func ListUser(cluster string, tenant string, count int, name string) error {
+// listUsers returns up to count users of the tenant starting at marker
+func listUsers(cluster string, tenant string, count int, marker string) ([]*User, error) {
+	var res []*User
+
 	c_cluster := C.CString(cluster)
 	defer C.free(unsafe.Pointer(c_cluster))
 
@@ -316,11 +319,9 @@ func ListUser(cluster string, tenant string, count int, name string) error {
 
 	conf, e := GetLibccowConf()
 	if e != nil {
-		return e
+		return nil, e
 	}
 
-	var marker string = "user-" + name
-
 	c_conf := C.CString(string(conf))
 	defer C.free(unsafe.Pointer(c_conf))
 
@@ -329,7 +330,7 @@ func ListUser(cluster string, tenant string, count int, name string) error {
 	ret := C.ccow_tenant_init(c_conf, c_cluster, C.strlen(c_cluster)+1,
 		c_tenant, C.strlen(c_tenant)+1, &tc)
 	if ret != 0 {
-		return fmt.Errorf("ccow_tenant_init err=%d", ret)
+		return nil, fmt.Errorf("ccow_tenant_init err=%d", ret)
 	}
 	defer C.ccow_tenant_term(tc)
 
@@ -339,13 +340,12 @@ func ListUser(cluster string, tenant string, count int, name string) error {
 	var iter C.ccow_lookup_t
 	ret = C.ccow_user_list(tc, c_marker, C.strlen(c_marker)+1, C.int(count), &iter)
 	if ret != 0 {
-		return fmt.Errorf("Get user list error=%d", ret)
+		return nil, fmt.Errorf("Get user list error=%d", ret)
 	}
 
 	defer C.ccow_lookup_release(iter)
 	var kv *C.struct_ccow_metadata_kv
 
-	fmt.Printf("%-12s\t%-7s %-9s %s\n", "NAME", "TYPE", "IDENTITY", "ADMINISTRATOR")
 	for {
 		kv = (*C.struct_ccow_metadata_kv)(C.ccow_lookup_iter(iter,
 			C.CCOW_MDTYPE_NAME_INDEX, -1))
@@ -366,17 +366,17 @@ func ListUser(cluster string, tenant string, count int, name string) error {
 		var ver C.uint8_t
 		u, _ := C.msgpack_unpack_init(kv.value, C.uint(kv.value_size), 0)
 		if u == nil {
-			return fmt.Errorf("%s: unpack init err=%d", GetFUNC(), ret)
+			return nil, fmt.Errorf("%s: unpack init err=%d", GetFUNC(), ret)
 		}
 		defer C.msgpack_unpack_free(u)
 
 		r, _ := C.msgpack_unpack_uint8(u, &ver)
 		if r != 0 {
-			return fmt.Errorf("%s: unpack version err=%d", GetFUNC(), ret)
+			return nil, fmt.Errorf("%s: unpack version err=%d", GetFUNC(), ret)
 		}
 
 		if ver != 2 {
-			return fmt.Errorf("Unpack user version error=%d", ver)
+			return nil, fmt.Errorf("Unpack user version error=%d", ver)
 		}
 
 		const buf_size = 4096
@@ -385,7 +385,7 @@ func ListUser(cluster string, tenant string, count int, name string) error {
 
 		ret = C.int(C.msgpack_unpack_str(u, c_buf, buf_size-1))
 		if ret != 0 {
-			return fmt.Errorf("Unpack user buffer error=%d", ret)
+			return nil, fmt.Errorf("Unpack user buffer error=%d", ret)
 		}
 
 		buf := C.GoString(c_buf)
@@ -393,8 +393,27 @@ func ListUser(cluster string, tenant string, count int, name string) error {
 		user := new(User)
 		err := json.Unmarshal([]byte(buf), user)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		res = append(res, user)
+	}
+
+	return res, nil
+}
+
+// GetUsers returns all users of the tenant
+func GetUsers(cluster string, tenant string) ([]*User, error) {
+	return listUsers(cluster, tenant, 1000000, "user-")
+}
+
+func ListUser(cluster string, tenant string, count int, name string) error {
+	users, err := listUsers(cluster, tenant, count, "user-"+name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%-12s\t%-7s %-9s %s\n", "NAME", "TYPE", "IDENTITY", "ADMINISTRATOR")
+	for _, user := range users {
 		var admin string = ""
 		if user.Admin == 1 {
 			admin = "A"
@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package efsutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// yamlJSONValue turns what yaml.v2 decodes into values encoding/json can
+// marshal, mapping keys become strings
+func yamlJSONValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			res[fmt.Sprint(k)] = yamlJSONValue(e)
+		}
+		return res
+	case []interface{}:
+		for i, e := range t {
+			t[i] = yamlJSONValue(e)
+		}
+		return t
+	}
+	return v
+}
+
+// YAMLToJSON converts a YAML document to JSON so that it can be decoded
+// with encoding/json and its struct tags. JSON documents pass unchanged.
+func YAMLToJSON(data []byte) ([]byte, error) {
+	trimmed := strings.TrimSpace(string(data))
+	if (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid(data) {
+		return data, nil
+	}
+
+	var doc interface{}
+	err := yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(yamlJSONValue(doc))
+}
+
+// YAMLString formats a string as a YAML scalar, quoted when it would not
+// read back unchanged as a plain one
+func YAMLString(s string) string {
+	out, err := yaml.Marshal(s)
+	if err != nil {
+		return fmt.Sprintf("%q", s)
+	}
+	return strings.TrimSuffix(string(out), "\n")
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package efsutil
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestYAMLToJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"json passes", `{"a": [1, 2]}`, `{"a": [1, 2]}`},
+		{"scalars", "a: b\nc: 1\nd: true\ne:", `{"a":"b","c":1,"d":true,"e":null}`},
+		{"nested mapping", "a:\n  b:\n    c: d", `{"a":{"b":{"c":"d"}}}`},
+		{"mappings in sequence", "- name: a\n  1: b", `[{"1":"b","name":"a"}]`},
+		{"flow", "a: {b: [c, 'd, e']}", `{"a":{"b":["c","d, e"]}}`},
+	}
+
+	for _, tt := range tests {
+		got, err := YAMLToJSON([]byte(tt.in))
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := YAMLToJSON([]byte("a: [b, c")); err == nil {
+		t.Errorf("expected an error for an unterminated flow sequence")
+	}
+}
+
+func TestYAMLString(t *testing.T) {
+	for _, s := range []string{"a", "", "don't", "a: b", "# c", "[a]", "~", "a #b", " a", "'a'", "yes", "1"} {
+		var got map[string]string
+		err := yaml.Unmarshal([]byte("k: "+YAMLString(s)), &got)
+		if err != nil {
+			t.Errorf("YAMLString(%q) = %s: %v", s, YAMLString(s), err)
+			continue
+		}
+		if got["k"] != s {
+			t.Errorf("YAMLString(%q) = %s reads back as %q", s, YAMLString(s), got["k"])
+		}
+	}
+}
@@ -27,10 +27,12 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/sabbot/module/efscli/apply"
 	"github.com/sabbot/module/efscli/bucket"
 	"github.com/sabbot/module/efscli/cluster"
 	"github.com/sabbot/module/efscli/config"
 	"github.com/sabbot/module/efscli/object"
+	"github.com/sabbot/module/efscli/profile"
 	"github.com/sabbot/module/efscli/service"
 	"github.com/sabbot/module/efscli/system"
 	"github.com/sabbot/module/efscli/tenant"
@@ -50,6 +52,8 @@ func main() {
 	efscliCmd.AddCommand(bucket.BucketCmd)
 	efscliCmd.AddCommand(cluster.ClusterCmd)
 	efscliCmd.AddCommand(object.ObjectCmd)
+	efscliCmd.AddCommand(profile.ProfileCmd)
+	efscliCmd.AddCommand(apply.ApplyCmd)
 	efscliCmd.AddCommand(service.ServiceCmd)
 	efscliCmd.AddCommand(system.SystemCmd)
 	efscliCmd.AddCommand(tenant.TenantCmd)
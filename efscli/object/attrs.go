@@ -0,0 +1,268 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package object
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/sabbot/module/efscli/validate"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+// attrDef is a system attribute which objects inherit, def is the libccow
+// built-in default if one is known
+type attrDef struct {
+	name string
+	key  string
+	def  string
+}
+
+var attrDefs = []attrDef{
+	{"replication-count", "ccow-replication-count", "3"},
+	{"sync-put", "ccow-sync-put", ""},
+	{"number-of-versions", "ccow-number-of-versions", "1"},
+	{"chunk-size", "ccow-chunkmap-chunk-size", "1048576"},
+	{"btree-marker", "ccow-chunkmap-btree-marker", ""},
+	{"ec-enabled", "ccow-ec-enabled", "0"},
+	{"ec-data-mode", "ccow-ec-data-mode", ""},
+	{"ec-trigger-policy", "ccow-ec-trigger-policy", ""},
+	{"select-policy", "ccow-select-policy", ""},
+	{"hash-type", "ccow-hash-type", ""},
+}
+
+var attrLevels = []string{"default", "cluster", "tenant", "bucket", "object"}
+
+// attrValue makes encoded attribute values readable
+func attrValue(name string, v string) string {
+	if v == "" {
+		return "-"
+	}
+	switch name {
+	case "ec-data-mode":
+		var m efsutil.ECMode
+		code, _ := strconv.Atoi(v)
+		if m.Decode(code) == nil {
+			return m.String()
+		}
+	case "ec-trigger-policy":
+		t, err := strconv.ParseUint(v, 10, 64)
+		if err == nil {
+			return fmt.Sprintf("%ds", t>>4)
+		}
+	case "select-policy":
+		if v == "2" {
+			return "capacity"
+		} else if v == "4" {
+			return "latency"
+		}
+	}
+	return v
+}
+
+// attrSystemDefaults reads tenant defaults of ccow.json, they override the
+// built-in ones, and the failure domain policy
+func attrSystemDefaults() (map[string]string, int) {
+	res := make(map[string]string)
+	for _, a := range attrDefs {
+		if a.def != "" {
+			res[a.key] = a.def
+		}
+	}
+
+	conf, err := efsutil.GetLibccowConf()
+	if err != nil {
+		return res, -1
+	}
+	var c struct {
+		Tenant struct {
+			FailureDomain    *int `json:"failure_domain"`
+			ReplicationCount int  `json:"replication_count"`
+			SyncPut          int  `json:"sync_put"`
+		} `json:"tenant"`
+	}
+	if json.Unmarshal(conf, &c) != nil {
+		return res, -1
+	}
+	if c.Tenant.ReplicationCount > 0 {
+		res["ccow-replication-count"] = strconv.Itoa(c.Tenant.ReplicationCount)
+	}
+	if c.Tenant.SyncPut > 0 {
+		res["ccow-sync-put"] = strconv.Itoa(c.Tenant.SyncPut)
+	}
+	fd := -1
+	if c.Tenant.FailureDomain != nil {
+		fd = *c.Tenant.FailureDomain
+	}
+	return res, fd
+}
+
+// failureDomains returns the number of failure domains of the policy
+// according to the FlexHash table, 0 if it is not known
+func failureDomains(policy int) (int, string) {
+	keys := map[int]string{0: "vdevcount", 1: "servercount", 2: "zonecount"}
+	names := map[int]string{0: "devices", 1: "servers", 2: "zones"}
+
+	key, ok := keys[policy]
+	if !ok {
+		return 0, ""
+	}
+
+	j, err := efsutil.GetFlexhashJson()
+	if err != nil {
+		return 0, names[policy]
+	}
+	var v map[string]interface{}
+	if json.Unmarshal(j, &v) != nil {
+		return 0, names[policy]
+	}
+	n, _ := v[key].(float64)
+	return int(n), names[policy]
+}
+
+// attrConflicts reports effective settings the cluster cannot satisfy
+func attrConflicts(eff map[string]string, fdPolicy int) []string {
+	var res []string
+
+	rc, _ := strconv.Atoi(eff["ccow-replication-count"])
+	domains, dname := failureDomains(fdPolicy)
+
+	if domains > 0 && rc > domains {
+		res = append(res, fmt.Sprintf("replication-count %d needs %d %s, the cluster has %d",
+			rc, rc, dname, domains))
+	}
+
+	if eff["ccow-ec-enabled"] == "1" {
+		var m efsutil.ECMode
+		code, _ := strconv.Atoi(eff["ccow-ec-data-mode"])
+		if m.Decode(code) != nil {
+			res = append(res, fmt.Sprintf("ec-data-mode %s is not a valid EC mode", eff["ccow-ec-data-mode"]))
+			return res
+		}
+		width := m.Data + m.Parity
+		if domains > 0 && width > domains {
+			res = append(res, fmt.Sprintf("ec-data-mode %s needs %d %s, the cluster has %d",
+				m.String(), width, dname, domains))
+		}
+		if m.Parity+1 != rc {
+			res = append(res, fmt.Sprintf("ec-data-mode %s expects replication-count %d, effective is %d",
+				m.String(), m.Parity+1, rc))
+		}
+	}
+
+	return res
+}
+
+func objectAttrs(opath string, explain bool) error {
+	s := strings.SplitN(opath, "/", 4)
+
+	obj, err := efsutil.GetMDPat(s[0], s[1], s[2], s[3], "ccow-")
+	if err != nil {
+		return fmt.Errorf("Object %s: %v", opath, err)
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetBorder(false)
+
+	if !explain {
+		table.SetHeader([]string{"Attribute", "Value"})
+		for _, a := range attrDefs {
+			table.Append([]string{a.name, attrValue(a.name, obj[a.key])})
+		}
+		table.Render()
+		return nil
+	}
+
+	defaults, fdPolicy := attrSystemDefaults()
+	cluster, _ := efsutil.GetMDPat(s[0], "", "", "", "ccow-")
+	tenant, _ := efsutil.GetMDPat(s[0], s[1], "", "", "ccow-")
+	bucket, err := efsutil.GetMDPat(s[0], s[1], s[2], "", "ccow-")
+	if err != nil {
+		return fmt.Errorf("Bucket %s/%s/%s: %v", s[0], s[1], s[2], err)
+	}
+	levels := []map[string]string{defaults, cluster, tenant, bucket, obj}
+
+	table.SetHeader([]string{"Attribute", "Effective", "Source", "Default", "Cluster", "Tenant", "Bucket"})
+	for _, a := range attrDefs {
+		eff := obj[a.key]
+
+		// the value comes from the most general level it is
+		// inherited unchanged from
+		src := len(levels) - 1
+		for i := src - 1; i >= 0; i-- {
+			v, ok := levels[i][a.key]
+			if !ok || v != eff {
+				break
+			}
+			src = i
+		}
+
+		row := []string{a.name, attrValue(a.name, eff), attrLevels[src]}
+		for i := 0; i < len(levels)-1; i++ {
+			row = append(row, attrValue(a.name, levels[i][a.key]))
+		}
+		table.Append(row)
+	}
+	table.Render()
+
+	conflicts := attrConflicts(obj, fdPolicy)
+	if len(conflicts) > 0 {
+		fmt.Println()
+	}
+	for _, c := range conflicts {
+		fmt.Printf("Conflict: %s\n", c)
+	}
+	return nil
+}
+
+var (
+	attrsExplain bool
+
+	attrsCmd = &cobra.Command{
+		Use:   "attrs <cluster>/<tenant>/<bucket>/<object>",
+		Short: "show effective object attributes",
+		Long: `show effective system attributes of an object, with --explain also the
+level each value is inherited from (default, cluster, tenant, bucket or
+object) and settings the cluster cannot satisfy`,
+		Args: validate.Object,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := objectAttrs(args[0], attrsExplain)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	attrsCmd.Flags().BoolVarP(&attrsExplain, "explain", "e", false, "Show where each value comes from and report conflicts")
+	ObjectCmd.AddCommand(attrsCmd)
+}
@@ -0,0 +1,449 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package object
+
+/*
+#include "ccow.h"
+*/
+import "C"
+import "unsafe"
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/spf13/cobra"
+)
+
+const (
+	EDGEFS_PATCH_MAGIC = "EFSPATCH"
+)
+
+// chunkRef is a reference entry of a version manifest, it points to a data
+// chunk or to a chunk manifest covering the offsets up to the next entry
+type chunkRef struct {
+	offset uint64
+	chid   string
+}
+
+// versionReader reads a single generation of an object chunk by chunk,
+// refs are the top level references of its version manifest by offset
+type versionReader struct {
+	tc          C.ccow_t
+	c           C.ccow_completion_t
+	c_bucket    *C.char
+	c_object    *C.char
+	genid       C.uint64_t
+	ioCount     C.int
+	maxIoCount  C.int
+	logicalSize uint64
+	chunkSize   uint64
+	refs        []chunkRef
+}
+
+func openVersion(opath string, gen uint64) (*versionReader, error) {
+	s := strings.SplitN(opath, "/", 4)
+
+	c_cluster := C.CString(s[0])
+	defer C.free(unsafe.Pointer(c_cluster))
+
+	c_tenant := C.CString(s[1])
+	defer C.free(unsafe.Pointer(c_tenant))
+
+	conf, err := efsutil.GetLibccowConf()
+	if err != nil {
+		return nil, err
+	}
+
+	c_conf := C.CString(string(conf))
+	defer C.free(unsafe.Pointer(c_conf))
+
+	r := &versionReader{
+		c_bucket:   C.CString(s[2]),
+		c_object:   C.CString(s[3]),
+		genid:      C.uint64_t(gen),
+		maxIoCount: 50000,
+	}
+
+	ret := C.ccow_tenant_init(c_conf, c_cluster, C.strlen(c_cluster)+1,
+		c_tenant, C.strlen(c_tenant)+1, &r.tc)
+	if ret != 0 {
+		r.free()
+		return nil, fmt.Errorf("ccow_tenant_init err=%d", ret)
+	}
+
+	var cont_flags C.int = 0
+	var iter C.ccow_lookup_t
+
+	ret = C.ccow_create_stream_completion(r.tc, nil, nil, r.maxIoCount, &r.c,
+		r.c_bucket, C.strlen(r.c_bucket)+1, r.c_object, C.strlen(r.c_object)+1,
+		&r.genid, &cont_flags, &iter)
+	if ret != 0 {
+		C.ccow_tenant_term(r.tc)
+		r.free()
+		return nil, fmt.Errorf("ccow_create_stream_completion err=%d", ret)
+	}
+
+	if cont_flags != C.CCOW_CONT_F_EXIST {
+		r.close()
+		return nil, fmt.Errorf("Object '%s' generation %d not found", opath, gen)
+	}
+
+	r.chunkSize = uint64(C.ccow_chunk_size(r.c))
+
+	var kv *C.struct_ccow_metadata_kv
+	for {
+		kv = (*C.struct_ccow_metadata_kv)(C.ccow_lookup_iter(iter,
+			C.CCOW_MDTYPE_METADATA|C.CCOW_MDTYPE_REFENTRIES, -1))
+		if kv == nil {
+			break
+		}
+		if kv.mdtype == C.CCOW_MDTYPE_REFENTRIES {
+			r.refs = append(r.refs, chunkRef{
+				offset: uint64(*(*C.uint64_t)(kv.value)),
+				chid:   chidString(&kv.chid),
+			})
+			continue
+		}
+		if strings.Compare(C.GoString(kv.key), C.RT_SYSKEY_LOGICAL_SIZE) == 0 {
+			r.logicalSize = uint64(*(*C.ulong)(kv.value))
+			continue
+		}
+		if strings.Compare(C.GoString(kv.key), C.RT_SYSKEY_CHUNKMAP_CHUNK_SIZE) == 0 {
+			r.chunkSize = uint64(*(*C.ulong)(kv.value))
+			continue
+		}
+		if strings.Compare(C.GoString(kv.key), C.RT_SYSKEY_CHUNKMAP_TYPE) == 0 {
+			if strings.Compare(C.GoString((*C.char)(kv.value)), "btree_key_val") == 0 {
+				r.close()
+				return nil, fmt.Errorf("Object '%s' is a kv database", opath)
+			}
+		}
+	}
+
+	sort.Slice(r.refs, func(i, j int) bool { return r.refs[i].offset < r.refs[j].offset })
+	return r, nil
+}
+
+// covering returns the reference whose range holds the offset. For a chunk
+// manifest it is the subtree root, equal roots mean an unchanged subtree.
+func (r *versionReader) covering(off uint64) (chunkRef, bool) {
+	i := sort.Search(len(r.refs), func(i int) bool { return r.refs[i].offset > off })
+	if i == 0 {
+		return chunkRef{}, false
+	}
+	return r.refs[i-1], true
+}
+
+func chidString(chid *C.uint512_t) string {
+	var buf [C.UINT512_BYTES*2 + 1]C.char
+	C.uint512_dump(chid, &buf[0], C.UINT512_BYTES*2+1)
+	return C.GoString(&buf[0])
+}
+
+func (r *versionReader) read(off uint64, buf unsafe.Pointer, n uint64) error {
+	var iov C.struct_iovec
+	iov.iov_base = buf
+	iov.iov_len = C.ulong(n)
+
+	ret := C.ccow_get_cont(r.c, &iov, 1, C.uint64_t(off), 1, &r.ioCount)
+	if ret != 0 {
+		return fmt.Errorf("ccow_get_cont err=%d", ret)
+	}
+
+	ret = C.ccow_wait(r.c, r.ioCount)
+	if ret != 0 {
+		return fmt.Errorf("ccow_wait err=%d", ret)
+	}
+
+	if r.ioCount == r.maxIoCount { // Reopen
+		ret = C.ccow_cancel(r.c)
+		if ret != 0 {
+			return fmt.Errorf("cannot cancel err=%d", ret)
+		}
+		r.ioCount = 0
+
+		var cont_flags C.int = 0
+		ret = C.ccow_create_stream_completion(r.tc, nil, nil, r.maxIoCount, &r.c,
+			r.c_bucket, C.strlen(r.c_bucket)+1, r.c_object, C.strlen(r.c_object)+1,
+			&r.genid, &cont_flags, nil)
+		if ret != 0 {
+			r.c = nil
+			return fmt.Errorf("ccow_create_stream_completion err=%d", ret)
+		}
+	}
+	return nil
+}
+
+func (r *versionReader) free() {
+	C.free(unsafe.Pointer(r.c_bucket))
+	C.free(unsafe.Pointer(r.c_object))
+}
+
+func (r *versionReader) close() {
+	if r.c != nil {
+		C.ccow_cancel(r.c)
+	}
+	C.ccow_tenant_term(r.tc)
+	r.free()
+}
+
+type diffRange struct {
+	Offset uint64
+	Length uint64
+}
+
+// diffVersion is <path>, <path>@<snapshot> or <path>@gen=<generation>
+type diffVersion struct {
+	path     string
+	snapshot string
+	gen      uint64
+}
+
+func parseDiffVersion(arg string) (diffVersion, error) {
+	var v diffVersion
+
+	s := strings.SplitN(arg, "/", 4)
+	if len(s) != 4 || s[0] == "" || s[1] == "" || s[2] == "" {
+		return v, fmt.Errorf("Invalid object version %s", arg)
+	}
+
+	i := strings.LastIndex(s[3], "@")
+	if i < 0 {
+		v.path = arg
+		return v, nil
+	}
+
+	v.path = strings.Join(s[:3], "/") + "/" + s[3][:i]
+	ver := s[3][i+1:]
+	if strings.HasPrefix(ver, "gen=") {
+		gen, err := strconv.ParseUint(ver[4:], 10, 64)
+		if err != nil || gen == 0 {
+			return v, fmt.Errorf("Invalid generation in %s", arg)
+		}
+		v.gen = gen
+	} else if ver == "" {
+		return v, fmt.Errorf("Empty snapshot name in %s", arg)
+	} else {
+		v.snapshot = ver
+	}
+	return v, nil
+}
+
+// openDiffVersion opens a reader for the version, snapshots are cloned to
+// a temporary object which is expunged by the returned cleanup function
+func openDiffVersion(v diffVersion, snapViewPath string) (*versionReader, func(), error) {
+	if v.snapshot == "" {
+		r, err := openVersion(v.path, v.gen)
+		if err != nil {
+			return nil, nil, err
+		}
+		return r, r.close, nil
+	}
+
+	// The clone shares chunks with the snapshot, only its version
+	// manifest is written
+	tmp := fmt.Sprintf("%s.diff-%d", v.path, time.Now().UnixNano())
+	err := snapshotClone(snapViewPath, v.path+"@"+v.snapshot, tmp, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s := strings.SplitN(tmp, "/", 4)
+	expunge := func() {
+		efsutil.ObjectExpunge(s[0], s[1], s[2], s[3])
+	}
+
+	r, err := openVersion(tmp, 0)
+	if err != nil {
+		expunge()
+		return nil, nil, err
+	}
+	return r, func() { r.close(); expunge() }, nil
+}
+
+func objectDiff(argA string, argB string, snapViewPath string, patchPath string) error {
+	va, err := parseDiffVersion(argA)
+	if err != nil {
+		return err
+	}
+	vb, err := parseDiffVersion(argB)
+	if err != nil {
+		return err
+	}
+	if va.path != vb.path {
+		return fmt.Errorf("Both versions have to belong to the same object: %s vs %s", va.path, vb.path)
+	}
+
+	if snapViewPath == "" {
+		snapViewPath = va.path + EDGEFS_SNAPVIEW_SUFFIX
+	}
+
+	ra, closeA, err := openDiffVersion(va, snapViewPath)
+	if err != nil {
+		return err
+	}
+	defer closeA()
+
+	rb, closeB, err := openDiffVersion(vb, snapViewPath)
+	if err != nil {
+		return err
+	}
+	defer closeB()
+
+	// Chunk references only line up when both versions share a chunk size
+	if ra.chunkSize != rb.chunkSize {
+		return fmt.Errorf("Versions have different chunk sizes %d and %d", ra.chunkSize, rb.chunkSize)
+	}
+	chunkSize := ra.chunkSize
+	size := ra.logicalSize
+	if rb.logicalSize > size {
+		size = rb.logicalSize
+	}
+
+	var patch *os.File
+	if patchPath != "" {
+		patch, err = os.Create(patchPath)
+		if err != nil {
+			return fmt.Errorf("Patch file '%s' error: %v", patchPath, err)
+		}
+		defer patch.Close()
+
+		hdr := make([]byte, 16)
+		copy(hdr, EDGEFS_PATCH_MAGIC)
+		binary.LittleEndian.PutUint64(hdr[8:], rb.logicalSize)
+		if _, err = patch.Write(hdr); err != nil {
+			return fmt.Errorf("Patch file write error: %v", err)
+		}
+	}
+
+	var buf unsafe.Pointer
+	if patch != nil {
+		buf = C.malloc(C.ulong(chunkSize))
+		defer C.free(buf)
+	}
+
+	var ranges []diffRange
+	var changed uint64
+
+	for off := uint64(0); off < size; off += chunkSize {
+		na := chunkLen(off, chunkSize, ra.logicalSize)
+		nb := chunkLen(off, chunkSize, rb.logicalSize)
+
+		ca, oka := ra.covering(off)
+		cb, okb := rb.covering(off)
+		if na == nb && oka == okb && ca == cb {
+			continue
+		}
+
+		n := na
+		if nb > n {
+			n = nb
+		}
+		changed += n
+
+		if len(ranges) > 0 && ranges[len(ranges)-1].Offset+ranges[len(ranges)-1].Length == off {
+			ranges[len(ranges)-1].Length += n
+		} else {
+			ranges = append(ranges, diffRange{Offset: off, Length: n})
+		}
+
+		// Ranges past the end of the new version are covered by its size
+		if patch != nil && nb > 0 {
+			if err := rb.read(off, buf, nb); err != nil {
+				return err
+			}
+			rec := make([]byte, 16)
+			binary.LittleEndian.PutUint64(rec, off)
+			binary.LittleEndian.PutUint64(rec[8:], nb)
+			if _, err = patch.Write(rec); err != nil {
+				return fmt.Errorf("Patch file write error: %v", err)
+			}
+			if _, err = patch.Write((*[1 << 30]byte)(buf)[:nb:nb]); err != nil {
+				return fmt.Errorf("Patch file write error: %v", err)
+			}
+		}
+	}
+
+	for _, r := range ranges {
+		fmt.Printf("%d\t%d\n", r.Offset, r.Length)
+	}
+	fmt.Printf("# %d range(s), %d of %d bytes changed, chunk size %d, size %d -> %d\n",
+		len(ranges), changed, size, chunkSize, ra.logicalSize, rb.logicalSize)
+
+	return nil
+}
+
+func chunkLen(off uint64, chunkSize uint64, size uint64) uint64 {
+	if off >= size {
+		return 0
+	}
+	if off+chunkSize > size {
+		return size - off
+	}
+	return chunkSize
+}
+
+var (
+	diffSnapView string
+	diffPatch    string
+
+	diffCmd = &cobra.Command{
+		Use:   "diff <path>[@<snapshot>|@gen=<generation>] <path>[@<snapshot>|@gen=<generation>]",
+		Short: "show byte ranges changed between two versions of an object",
+		Long: `show byte ranges changed between two snapshots or generations of an object
+
+Versions are compared by the chunk references of their version manifests
+without reading payload, every changed range is printed as
+"<offset> <length>". A chunk manifest which differs marks its whole range
+as changed. Snapshots are read through a temporary clone next to the
+object. Snapshots are looked up in <path>.snapview unless
+--snapview is given. A version without suffix is the current one.
+
+With --patch the changed ranges of the second version are written to a
+file: the 8 byte magic "EFSPATCH", the new logical size as uint64, then
+records of uint64 offset, uint64 length and the data. All integers are
+little endian.`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := objectDiff(args[0], args[1], diffSnapView, diffPatch)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	diffCmd.Flags().StringVarP(&diffSnapView, "snapview", "s", "", "Snapview object holding the snapshots")
+	diffCmd.Flags().StringVarP(&diffPatch, "patch", "p", "", "Write the changed ranges of the second version to a patch file")
+	ObjectCmd.AddCommand(diffCmd)
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package object
+
+/*
+#include "ccow.h"
+*/
+import "C"
+import "unsafe"
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/sabbot/module/efscli/efsutil"
+)
+
+// ObjectReader streams one version of an object, it is used by bucket
+// export to write payloads without staging them on local disk
+type ObjectReader struct {
+	r       *versionReader
+	cleanup func()
+	buf     unsafe.Pointer
+	off     uint64
+	bufOff  uint64
+	bufLen  uint64
+}
+
+func newObjectReader(r *versionReader, cleanup func()) *ObjectReader {
+	return &ObjectReader{
+		r:       r,
+		cleanup: cleanup,
+		buf:     C.malloc(C.ulong(r.chunkSize)),
+	}
+}
+
+// OpenObjectReader opens generation gen of the object, 0 is the latest one
+func OpenObjectReader(opath string, gen uint64) (*ObjectReader, error) {
+	r, err := openVersion(opath, gen)
+	if err != nil {
+		return nil, err
+	}
+	return newObjectReader(r, r.close), nil
+}
+
+// OpenSnapshotReader opens a snapshot through a temporary clone which is
+// expunged on Close
+func OpenSnapshotReader(snapViewPath string, snapshot string) (*ObjectReader, error) {
+	v, err := parseDiffVersion(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if v.snapshot == "" {
+		return nil, fmt.Errorf("Not a snapshot: %s", snapshot)
+	}
+
+	r, cleanup, err := openDiffVersion(v, snapViewPath)
+	if err != nil {
+		return nil, err
+	}
+	return newObjectReader(r, cleanup), nil
+}
+
+func (o *ObjectReader) Size() uint64 {
+	return o.r.logicalSize
+}
+
+func (o *ObjectReader) Read(p []byte) (int, error) {
+	size := o.r.logicalSize
+	if o.off >= size {
+		return 0, io.EOF
+	}
+
+	if o.off < o.bufOff || o.off >= o.bufOff+o.bufLen {
+		start := o.off / o.r.chunkSize * o.r.chunkSize
+		n := chunkLen(start, o.r.chunkSize, size)
+		err := o.r.read(start, o.buf, n)
+		if err != nil {
+			return 0, err
+		}
+		o.bufOff = start
+		o.bufLen = n
+	}
+
+	b := (*[1 << 30]byte)(o.buf)[:o.bufLen:o.bufLen]
+	n := copy(p, b[o.off-o.bufOff:])
+	o.off += uint64(n)
+	return n, nil
+}
+
+func (o *ObjectReader) Close() {
+	C.free(o.buf)
+	o.cleanup()
+}
+
+// ObjectVersions returns generations of the object which are still
+// retained besides the latest one, in ascending order. Only the last
+// number-of-versions generations are probed.
+func ObjectVersions(opath string) ([]uint64, error) {
+	s := strings.SplitN(opath, "/", 4)
+	md, err := efsutil.GetMDPat(s[0], s[1], s[2], s[3], "ccow-")
+	if err != nil {
+		return nil, err
+	}
+
+	cur, _ := strconv.ParseUint(md["ccow-tx-generation-id"], 10, 64)
+	nv, _ := strconv.ParseUint(md["ccow-number-of-versions"], 10, 64)
+	if cur <= 1 || nv <= 1 {
+		return nil, nil
+	}
+
+	first := uint64(1)
+	if cur > nv {
+		first = cur - nv + 1
+	}
+
+	var res []uint64
+	for gen := first; gen < cur; gen++ {
+		r, err := openVersion(opath, gen)
+		if err != nil {
+			continue
+		}
+		r.close()
+		res = append(res, gen)
+	}
+	return res, nil
+}
+
+// SnapshotImport adds a snapshot of the current state of its source object
+// and keeps the creation time and tags recorded by the exporting cluster
+func SnapshotImport(snapViewPath string, meta SnapshotMeta) error {
+	err := SnapshotAdd(snapViewPath, meta.Name, meta.Tags, nil)
+	if err != nil {
+		return err
+	}
+
+	cur := snapshotSourceMeta(meta.Name, meta.Tags)
+	if meta.Created != 0 {
+		cur.Created = meta.Created
+	}
+	return snapshotSaveMeta(snapViewPath, cur)
+}
@@ -25,6 +25,7 @@ package object
 
 /*
 #include <stdio.h>
+#include <unistd.h>
 #include "ccow.h"
 */
 import "C"
@@ -40,7 +41,7 @@ import (
 	"github.com/spf13/cobra"
 )
 
-func ObjectGet(args []string) error {
+func ObjectGet(args []string, sparse bool) error {
 	opath := args[0]
 
 	s := strings.SplitN(opath, "/", 4)
@@ -63,6 +64,13 @@ func ObjectGet(args []string) error {
 	}
 	defer C.fclose(fp)
 
+	// Holes are only left in regular files, a block device or a pipe
+	// has to receive every byte
+	if sparse {
+		fi, err := os.Stat(fpath)
+		sparse = err == nil && fi.Mode().IsRegular()
+	}
+
 	c_opath := C.CString(opath)
 	defer C.free(unsafe.Pointer(c_opath))
 
@@ -151,6 +159,7 @@ func ObjectGet(args []string) error {
 	defer C.free(unsafe.Pointer(c_buf))
 
 	var iov C.struct_iovec
+	var holeTail bool = false
 
 	for {
 		n = C.uint64_t(chunk_size)
@@ -172,9 +181,15 @@ func ObjectGet(args []string) error {
 			return fmt.Errorf("ccow_wait err=%d", ret)
 		}
 
-		nw, _ = C.fwrite(c_buf, 1, n, fp)
-		if nw < n {
-			return fmt.Errorf("File write error")
+		if sparse && isZeroChunk(c_buf, n) &&
+			C.fseeko(fp, C.off_t(n), C.SEEK_CUR) == 0 {
+			holeTail = true
+		} else {
+			nw, _ = C.fwrite(c_buf, 1, n, fp)
+			if nw < n {
+				return fmt.Errorf("File write error")
+			}
+			holeTail = false
 		}
 
 		doff += n
@@ -206,17 +221,28 @@ func ObjectGet(args []string) error {
 		}
 	}
 
+	// A trailing hole does not extend the file by itself
+	if holeTail {
+		C.fflush(fp)
+		r, err := C.ftruncate(C.fileno(fp), C.off_t(logical_size))
+		if r != 0 {
+			return fmt.Errorf("File truncate error: %v", err)
+		}
+	}
+
 	return nil
 }
 
 var (
+	getNoSparse bool
+
 	getCmd = &cobra.Command{
 		Use:   "get  <cluster>/<tenant>/<bucket>/<object> [<file>]",
 		Short: "get a new object",
 		Long:  "get a new object from cluster and write to file",
 		Args:  validate.ObjectGet,
 		Run: func(cmd *cobra.Command, args []string) {
-			err := ObjectGet(args)
+			err := ObjectGet(args, !getNoSparse)
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
@@ -226,5 +252,6 @@ var (
 )
 
 func init() {
+	getCmd.Flags().BoolVarP(&getNoSparse, "no-sparse", "", false, "Write all-zero chunks instead of leaving holes")
 	ObjectCmd.AddCommand(getCmd)
 }
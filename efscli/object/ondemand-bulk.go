@@ -0,0 +1,221 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package object
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/sabbot/module/efscli/validate"
+
+	"github.com/im-kulikov/sizefmt"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+type ondemandResult struct {
+	name string
+	err  error
+}
+
+// ondemandObjects resolves <cluster>/<tenant>/<bucket>[/<prefix>] into the
+// list of live objects, optionally narrowed by a shell glob pattern
+func ondemandObjects(bpath string, pattern string) ([]string, []efsutil.ObjectEntry, error) {
+	s := strings.SplitN(bpath, "/", 4)
+	prefix := ""
+	if len(s) == 4 {
+		prefix = s[3]
+	}
+
+	entries, err := efsutil.ListObjects(s[0], s[1], s[2], prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if pattern == "" {
+		return s, entries, nil
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, nil, fmt.Errorf("Invalid pattern %s: %v", pattern, err)
+	}
+
+	var res []efsutil.ObjectEntry
+	for _, e := range entries {
+		if ok, _ := path.Match(pattern, e.Name); ok {
+			res = append(res, e)
+		}
+	}
+	return s, res, nil
+}
+
+// ondemandParallel runs fn over every entry using up to jobs workers and
+// returns the per-object failures
+func ondemandParallel(entries []efsutil.ObjectEntry, jobs int, fn func(e efsutil.ObjectEntry) error) []ondemandResult {
+	var failed []ondemandResult
+
+	errs := efsutil.Parallel(len(entries), jobs, func(i int) error {
+		return fn(entries[i])
+	})
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, ondemandResult{name: entries[i].Name, err: err})
+		}
+	}
+
+	return failed
+}
+
+func OndemandStatus(bpath string, pattern string, jobs int) error {
+	s, entries, err := ondemandObjects(bpath, pattern)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]uint64)
+	bytes := make(map[string]uint64)
+	var mu sync.Mutex
+
+	failed := ondemandParallel(entries, jobs, func(e efsutil.ObjectEntry) error {
+		pol, err := efsutil.GetOndemandPolicyString(s[0], s[1], s[2], e.Name)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		counts[pol]++
+		bytes[pol] += e.Size
+		mu.Unlock()
+		return nil
+	})
+
+	for _, f := range failed {
+		fmt.Printf("ERROR: %s: %v\n", f.name, f.err)
+	}
+
+	var totalCount, totalBytes uint64
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetBorder(false)
+	table.SetHeader([]string{"Policy", "Objects", "Bytes"})
+	for _, pol := range efsutil.OndemandPolicyNames() {
+		table.Append([]string{pol, fmt.Sprintf("%d", counts[pol]),
+			strings.Trim(sizefmt.ByteSize(float64(bytes[pol])), " ")})
+		totalCount += counts[pol]
+		totalBytes += bytes[pol]
+	}
+	table.SetFooter([]string{"Total", fmt.Sprintf("%d", totalCount),
+		strings.Trim(sizefmt.ByteSize(float64(totalBytes)), " ")})
+	table.Render()
+
+	if len(failed) > 0 {
+		return fmt.Errorf("Failed to fetch policy of %d object(s)", len(failed))
+	}
+	return nil
+}
+
+func OndemandBulk(bpath string, pattern string, jobs int, policy int) error {
+	s, entries, err := ondemandObjects(bpath, pattern)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		fmt.Printf("No objects found at %s\n", bpath)
+		return nil
+	}
+
+	base := s[0] + "/" + s[1] + "/" + s[2] + "/"
+	failed := ondemandParallel(entries, jobs, func(e efsutil.ObjectEntry) error {
+		return setOndemandPolicy(base+e.Name, 0, policy)
+	})
+
+	for _, f := range failed {
+		fmt.Printf("ERROR: %s: %v\n", f.name, f.err)
+	}
+	fmt.Printf("Processed %d object(s), %d succeeded, %d failed\n",
+		len(entries), len(entries)-len(failed), len(failed))
+
+	if len(failed) > 0 {
+		return fmt.Errorf("Policy change failed for %d object(s)", len(failed))
+	}
+	return nil
+}
+
+func ondemandBulkCmd(use string, short string, policy int) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   use + " <cluster>/<tenant>/<bucket>[/<prefix>]",
+		Short: short,
+		Long:  short + " for every object under a bucket or prefix",
+		Args:  validate.ObjectOnDemandBulk,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := OndemandBulk(args[0], ondemandPattern, ondemandJobs, policy)
+			if err != nil {
+				fmt.Printf("ERROR: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&ondemandPattern, "pattern", "p", "", "Shell pattern the object name has to match")
+	cmd.Flags().IntVarP(&ondemandJobs, "jobs", "j", 8, "Number of objects to process in parallel")
+	return cmd
+}
+
+var (
+	ondemandPattern string
+	ondemandJobs    int
+
+	ondemandCmd = &cobra.Command{
+		Use:   "ondemand",
+		Short: "Bucket and prefix wide ondemand policy operations",
+		Long:  "Report and change ondemand policy of all objects under a bucket or prefix",
+	}
+
+	ondemandStatusCmd = &cobra.Command{
+		Use:   "status <cluster>/<tenant>/<bucket>[/<prefix>]",
+		Short: "Summary of objects and bytes per ondemand policy",
+		Long:  "Summary of objects and bytes per ondemand policy (LOCAL, CACHED, PINNED, PERSISTENT)",
+		Args:  validate.ObjectOnDemandBulk,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := OndemandStatus(args[0], ondemandPattern, ondemandJobs)
+			if err != nil {
+				fmt.Printf("ERROR: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	ondemandStatusCmd.Flags().StringVarP(&ondemandPattern, "pattern", "p", "", "Shell pattern the object name has to match")
+	ondemandStatusCmd.Flags().IntVarP(&ondemandJobs, "jobs", "j", 8, "Number of objects to process in parallel")
+
+	ondemandCmd.AddCommand(ondemandStatusCmd)
+	ondemandCmd.AddCommand(ondemandBulkCmd("pin", "Pin cacheable objects", ondemandPolicyPin))
+	ondemandCmd.AddCommand(ondemandBulkCmd("unpin", "Unpin cacheable objects", ondemandPolicyUnpin))
+	ondemandCmd.AddCommand(ondemandBulkCmd("persist", "Persist cacheable objects", ondemandPolicyPersist))
+	ObjectCmd.AddCommand(ondemandCmd)
+}
@@ -24,7 +24,9 @@
 package object
 
 /*
+#define _GNU_SOURCE
 #include <stdio.h>
+#include <unistd.h>
 #include "ccow.h"
 */
 import "C"
@@ -34,13 +36,32 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"syscall"
 
 	"github.com/sabbot/module/efscli/efsutil"
 	"github.com/sabbot/module/efscli/validate"
 	"github.com/spf13/cobra"
 )
 
-func objectPut(opath string, fpath string, flags []efsutil.FlagValue) error {
+// isZeroChunk reports whether the first n bytes of a C buffer are all zero
+func isZeroChunk(buf unsafe.Pointer, n C.uint64_t) bool {
+	b := (*[1 << 30]byte)(buf)[:n:n]
+	for i := range b {
+		if b[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func objectPut(opath string, fpath string, flags []efsutil.FlagValue, sparse bool) error {
+	return ObjectPut(opath, fpath, nil, flags, sparse)
+}
+
+// ObjectPut stores the file as a new version of the object. The default
+// attributes are taken from attrs, or from the bucket when attrs is nil,
+// and then overridden by flags.
+func ObjectPut(opath string, fpath string, attrs map[string]string, flags []efsutil.FlagValue, sparse bool) error {
 	e := validate.Flags(flags)
 	if e != nil {
 		return e
@@ -63,9 +84,12 @@ func objectPut(opath string, fpath string, flags []efsutil.FlagValue) error {
 
 	s := strings.SplitN(opath, "/", 4)
 
-	bucket, errb := efsutil.GetMDPat(s[0], s[1], s[2], "", "")
-	if errb != nil {
-		return errb
+	if attrs == nil {
+		bucket, errb := efsutil.GetMDPat(s[0], s[1], s[2], "", "")
+		if errb != nil {
+			return errb
+		}
+		attrs = bucket
 	}
 
 	c_cluster := C.CString(s[0])
@@ -112,7 +136,7 @@ func objectPut(opath string, fpath string, flags []efsutil.FlagValue) error {
 		return fmt.Errorf("ccow_create_stream_completion err=%d", ret)
 	}
 
-	err = efsutil.InheritBucketAttributes(unsafe.Pointer(c), bucket)
+	err = efsutil.InheritBucketAttributes(unsafe.Pointer(c), attrs)
 	if err != nil {
 		return err
 	}
@@ -137,17 +161,11 @@ func objectPut(opath string, fpath string, flags []efsutil.FlagValue) error {
 
 	var iov C.struct_iovec
 
-	for {
-		n, _ = C.fread(unsafe.Pointer(c_buf), 1, C.ulong(chunk_size), fp)
-
-		if n == 0 {
-			break
-		}
-
+	putChunk := func(off C.uint64_t, n C.uint64_t) error {
 		iov.iov_base = unsafe.Pointer(c_buf)
 		iov.iov_len = C.ulong(n)
 
-		ret = C.ccow_put_cont(c, &iov, 1, doff, 1, &io_count)
+		ret = C.ccow_put_cont(c, &iov, 1, off, 1, &io_count)
 		if ret != 0 {
 			return fmt.Errorf("ccow_put_cont err=%d", ret)
 		}
@@ -157,8 +175,6 @@ func objectPut(opath string, fpath string, flags []efsutil.FlagValue) error {
 			return fmt.Errorf("ccow_wait err=%d", ret)
 		}
 
-		doff += n
-
 		if io_count == max_io_count { // Reopen
 			ret = C.ccow_finalize(c, nil)
 			if ret != 0 {
@@ -173,6 +189,82 @@ func objectPut(opath string, fpath string, flags []efsutil.FlagValue) error {
 				return fmt.Errorf("ccow_create_stream_completion err=%d", ret)
 			}
 		}
+		return nil
+	}
+
+	// Regular files and block devices are read with pread() so that holes
+	// can be located with SEEK_DATA, anything else is streamed with fread()
+	fd := C.fileno(fp)
+	fsize, serr := C.lseek(fd, 0, C.SEEK_END)
+	seekable := serr == nil && fsize >= 0
+
+	// Unwritten ranges of an object read back as zeros, thus all-zero
+	// chunks are not stored. The last chunk is always written to keep
+	// the logical size of the object.
+	var zeroTail bool = false
+	var zeroOff, zeroLen C.uint64_t
+
+	for {
+		if seekable && sparse && doff < C.uint64_t(fsize) {
+			last := (C.uint64_t(fsize) - 1) / C.uint64_t(chunk_size) * C.uint64_t(chunk_size)
+			next := last
+			d, derr := C.lseek(fd, C.off_t(doff), C.SEEK_DATA)
+			if derr == nil && d >= 0 {
+				next = C.uint64_t(d) / C.uint64_t(chunk_size) * C.uint64_t(chunk_size)
+			} else if derr != syscall.ENXIO {
+				next = doff
+			}
+			if next > last {
+				next = last
+			}
+			if next > doff {
+				doff = next
+			}
+		}
+
+		if seekable {
+			n = C.uint64_t(chunk_size)
+			if doff+n > C.uint64_t(fsize) {
+				n = C.uint64_t(fsize) - doff
+			}
+			if n == 0 {
+				break
+			}
+			nr, rerr := C.pread(fd, c_buf, C.size_t(n), C.off_t(doff))
+			if nr < 0 || C.uint64_t(nr) != n {
+				return fmt.Errorf("Read input file '%s' error: %v", fpath, rerr)
+			}
+		} else {
+			n, _ = C.fread(unsafe.Pointer(c_buf), 1, C.ulong(chunk_size), fp)
+			if n == 0 {
+				break
+			}
+		}
+
+		isLast := seekable && doff+n >= C.uint64_t(fsize)
+		if sparse && !isLast && isZeroChunk(c_buf, n) {
+			zeroTail = true
+			zeroOff = doff
+			zeroLen = n
+			doff += n
+			continue
+		}
+		zeroTail = false
+
+		err = putChunk(doff, n)
+		if err != nil {
+			return err
+		}
+
+		doff += n
+	}
+
+	if zeroTail {
+		C.memset(c_buf, 0, C.size_t(zeroLen))
+		err = putChunk(zeroOff, zeroLen)
+		if err != nil {
+			return err
+		}
 	}
 
 	if io_count > 0 {
@@ -190,7 +282,8 @@ func objectPut(opath string, fpath string, flags []efsutil.FlagValue) error {
 }
 
 var (
-	flagsPut []efsutil.FlagValue
+	flagsPut    []efsutil.FlagValue
+	putNoSparse bool
 
 	putCmd = &cobra.Command{
 		Use:   "put  <cluster>/<tenant>/<bucket>/<object> <file>",
@@ -198,7 +291,7 @@ var (
 		Long:  "put a new object from file",
 		Args:  validate.ObjectPutGet,
 		Run: func(cmd *cobra.Command, args []string) {
-			err := objectPut(args[0], args[1], flagsPut)
+			err := objectPut(args[0], args[1], flagsPut, !putNoSparse)
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
@@ -210,5 +303,6 @@ var (
 func init() {
 	flagsPut = make([]efsutil.FlagValue, len(flagNames))
 	efsutil.ReadAttributes(putCmd, flagNames, flagsPut)
+	putCmd.Flags().BoolVarP(&putNoSparse, "no-sparse", "", false, "Store all-zero chunks instead of skipping them")
 	ObjectCmd.AddCommand(putCmd)
 }
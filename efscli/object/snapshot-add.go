@@ -40,7 +40,7 @@ import (
 	"github.com/spf13/cobra"
 )
 
-func snapshotAdd(snapViewPath, sourceSnapshotPath string,  flags []efsutil.FlagValue) error {
+func SnapshotAdd(snapViewPath, sourceSnapshotPath string, tags map[string]string, flags []efsutil.FlagValue) error {
 
 	c_svPath := C.CString(snapViewPath)
 	defer C.free(unsafe.Pointer(c_svPath))
@@ -114,6 +114,8 @@ func snapshotAdd(snapViewPath, sourceSnapshotPath string,  flags []efsutil.FlagV
         }
         defer C.ccow_tenant_term(sstc)
 
+	meta := snapshotSourceMeta(sourceSnapshotPath, tags)
+
 	ret = C.ccow_snapshot_create(sstc, snapview_t, c_ssBucket, C.strlen(c_ssBucket) + 1, c_ssObject, C.strlen(c_ssObject) + 1, c_snapshot, C.strlen(c_snapshot) + 1)
 	if ret != 0 {
 		if ret == -C.EEXIST {
@@ -126,11 +128,17 @@ func snapshotAdd(snapViewPath, sourceSnapshotPath string,  flags []efsutil.FlagV
 
 	fmt.Printf("Snapshot %s has been added to %s\n", sourceSnapshotPath, snapViewPath)
 
+	err = snapshotSaveMeta(snapViewPath, meta)
+	if err != nil {
+		fmt.Printf("Warning: snapshot metadata not recorded: %v\n", err)
+	}
+
 	return nil
 }
 
 var (
 	flagsSnapshotAdd []efsutil.FlagValue
+	snapshotAddTags  []string
 
 	snapshotAddCmd = &cobra.Command{
 		Use:   "snapshot-add object.snapview object-path@snapshot-name",
@@ -168,7 +176,13 @@ var (
 				return
 			}
 
-			err := snapshotAdd(args[0], args[1], flagsSnapshotAdd)
+			tags, err := parseSnapshotTags(snapshotAddTags)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			err = SnapshotAdd(args[0], args[1], tags, flagsSnapshotAdd)
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
@@ -180,5 +194,6 @@ var (
 func init() {
 	//flagsSnapshotAdd = make([]efsutil.FlagValue, len(flagNames))
 	//efsutil.ReadAttributes(snapshotAddCmd, flagNames, flagsSnapshotAdd)
+	snapshotAddCmd.Flags().StringSliceVarP(&snapshotAddTags, "tag", "t", nil, "Snapshot tag key=value, may be repeated")
 	ObjectCmd.AddCommand(snapshotAddCmd)
 }
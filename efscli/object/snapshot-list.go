@@ -31,16 +31,21 @@ import "C"
 import "unsafe"
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/sabbot/module/efscli/efsutil"
 	"github.com/sabbot/module/efscli/validate"
+
+	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
 )
 
-func snapshotList(snapViewPath, pattern string, count uint32, flags []efsutil.FlagValue) error {
+func GetSnapshots(snapViewPath, pattern string, count uint32) ([]string, error) {
+	var res []string
 
 	c_pattern := C.CString(pattern)
 	defer C.free(unsafe.Pointer(c_pattern))
@@ -62,7 +67,7 @@ func snapshotList(snapViewPath, pattern string, count uint32, flags []efsutil.Fl
 	// Libccow Init
 	conf, err := efsutil.GetLibccowConf()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	c_conf := C.CString(string(conf))
@@ -73,21 +78,21 @@ func snapshotList(snapViewPath, pattern string, count uint32, flags []efsutil.Fl
 	ret := C.ccow_tenant_init(c_conf, c_svCluster, C.strlen(c_svCluster)+1,
 		c_svTenant, C.strlen(c_svTenant)+1, &svtc)
 	if ret != 0 {
-		return fmt.Errorf("%: snapView ccow_tenant_init err=%d\n", efsutil.GetFUNC(), ret)
+		return nil, fmt.Errorf("%: snapView ccow_tenant_init err=%d\n", efsutil.GetFUNC(), ret)
 	}
 	defer C.ccow_tenant_term(svtc)
 
 	var svc C.ccow_completion_t
 	ret = C.ccow_create_completion(svtc, nil, nil, 1, &svc)
 	if ret != 0 {
-		return fmt.Errorf("%s: snapview ccow_create_completion err=%d\n", efsutil.GetFUNC(), ret)
+		return nil, fmt.Errorf("%s: snapview ccow_create_completion err=%d\n", efsutil.GetFUNC(), ret)
 	}
 
 	var snapview_t C.ccow_snapview_t
 
 	ret = C.ccow_snapview_create(svtc, &snapview_t, c_svBucket, C.strlen(c_svBucket)+1, c_svObject, C.strlen(c_svObject)+1)
 	if ret != 0 && ret != -C.EEXIST {
-		return fmt.Errorf("%s: snapView ccow_snapview_create err=%d\n", efsutil.GetFUNC(), ret)
+		return nil, fmt.Errorf("%s: snapView ccow_snapview_create err=%d\n", efsutil.GetFUNC(), ret)
 	}
 	defer C.ccow_snapview_destroy(svtc, snapview_t)
 
@@ -100,10 +105,10 @@ func snapshotList(snapViewPath, pattern string, count uint32, flags []efsutil.Fl
 		}
 
 		if ret == -C.ENOENT {
-			return nil
+			return res, nil
 		}
 
-		return fmt.Errorf("ccow_snapshot_lookup err=%d\n", ret)
+		return nil, fmt.Errorf("ccow_snapshot_lookup err=%d\n", ret)
 	}
 
 	var kv *C.struct_ccow_metadata_kv
@@ -119,18 +124,97 @@ func snapshotList(snapViewPath, pattern string, count uint32, flags []efsutil.Fl
 		if strings.HasPrefix(C.GoString(kv.key), pattern) {
 			//found = 1
 			if !efsutil.IsSystemName(C.GoString(kv.key)) {
-				fmt.Printf("%s\n", C.GoString(kv.key))
+				res = append(res, C.GoString(kv.key))
 			}
 			continue
 		}
 	}
 	C.ccow_lookup_release(snapshotIterator)
 
+	return res, nil
+}
+
+func snapshotList(snapViewPath, pattern string, count uint32, flags []efsutil.FlagValue) error {
+	snaps, err := GetSnapshotsMeta(snapViewPath, pattern)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var filtered []SnapshotMeta
+	for _, meta := range snaps {
+		if snapshotListOlder != "" || snapshotListNewer != "" {
+			// age of snapshots without recorded metadata is unknown
+			if meta.Created == 0 {
+				continue
+			}
+			age := now.Sub(time.Unix(meta.Created, 0))
+			if snapshotListOlder != "" {
+				d, err := parseInterval(snapshotListOlder)
+				if err != nil {
+					return err
+				}
+				if age < d {
+					continue
+				}
+			}
+			if snapshotListNewer != "" {
+				d, err := parseInterval(snapshotListNewer)
+				if err != nil {
+					return err
+				}
+				if age > d {
+					continue
+				}
+			}
+		}
+		filtered = append(filtered, meta)
+	}
+
+	err = sortSnapshotsMeta(filtered, snapshotListSort, snapshotListReverse)
+	if err != nil {
+		return err
+	}
+
+	if uint32(len(filtered)) > count {
+		filtered = filtered[:count]
+	}
+
+	if snapshotListOutput == "json" {
+		if filtered == nil {
+			filtered = []SnapshotMeta{}
+		}
+		data, err := json.MarshalIndent(filtered, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", data)
+		return nil
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetBorder(false)
+	table.SetHeader([]string{"Snapshot", "Source", "Generation", "Created", "Size", "Tags"})
+	for _, meta := range filtered {
+		gen := "-"
+		if meta.Generation != 0 {
+			gen = fmt.Sprintf("%d", meta.Generation)
+		}
+		table.Append([]string{meta.Name, meta.Source, gen, formatSnapshotCreated(meta.Created),
+			fmt.Sprintf("%d", meta.Size), formatSnapshotTags(meta.Tags)})
+	}
+	table.Render()
+
 	return nil
 }
 
 var (
-	flagsSnapshotList []efsutil.FlagValue
+	flagsSnapshotList   []efsutil.FlagValue
+	snapshotListSort    string
+	snapshotListReverse bool
+	snapshotListOlder   string
+	snapshotListNewer   string
+	snapshotListOutput  string
 
 	snapshotListCmd = &cobra.Command{
 		Use:   "snapshot-list snapViewPath <namePattern>",
@@ -173,5 +257,10 @@ var (
 func init() {
 	//flagsSnapshotList = make([]efsutil.FlagValue, len(flagNames))
 	//efsutil.ReadAttributes(snapshotListCmd, flagNames, flagsSnapshotList)
+	snapshotListCmd.Flags().StringVarP(&snapshotListSort, "sort", "s", "name", "Sort by name, created, size or generation")
+	snapshotListCmd.Flags().BoolVarP(&snapshotListReverse, "reverse", "r", false, "Reverse the sort order")
+	snapshotListCmd.Flags().StringVarP(&snapshotListOlder, "older-than", "", "", "Only snapshots older than the age, e.g. 12h, 7d")
+	snapshotListCmd.Flags().StringVarP(&snapshotListNewer, "newer-than", "", "", "Only snapshots newer than the age, e.g. 12h, 7d")
+	snapshotListCmd.Flags().StringVarP(&snapshotListOutput, "output", "o", "", "Output format: json")
 	ObjectCmd.AddCommand(snapshotListCmd)
 }
@@ -40,7 +40,7 @@ import (
 	"github.com/spf13/cobra"
 )
 
-func snapshotRm(snapViewPath, sourceSnapshotPath string, flags []efsutil.FlagValue) error {
+func SnapshotRm(snapViewPath, sourceSnapshotPath string, flags []efsutil.FlagValue) error {
 
 	c_svPath := C.CString(snapViewPath)
 	defer C.free(unsafe.Pointer(c_svPath))
@@ -137,6 +137,11 @@ func snapshotRm(snapViewPath, sourceSnapshotPath string, flags []efsutil.FlagVal
 	}
 
 	fmt.Printf("Snapshot %s has been removed from %s\n", sourceSnapshotPath, snapViewPath)
+
+	err = snapshotDropMeta(snapViewPath, sourceSnapshotPath)
+	if err != nil {
+		fmt.Printf("Warning: snapshot metadata not removed: %v\n", err)
+	}
 	defer C.ccow_snapview_destroy(svtc, snapview_t)
 
 	return nil
@@ -181,7 +186,7 @@ var (
 				return
 			}
 
-			err := snapshotRm(args[0], args[1], flagsSnapshotRm)
+			err := SnapshotRm(args[0], args[1], flagsSnapshotRm)
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
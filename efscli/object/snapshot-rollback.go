@@ -0,0 +1,230 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package object
+
+/*
+#include "ccow.h"
+#include "errno.h"
+*/
+import "C"
+import "unsafe"
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/spf13/cobra"
+)
+
+func snapshotRollbackInPlace(snapViewPath string, snapshot string) error {
+	c_ssName := C.CString(snapshot)
+	defer C.free(unsafe.Pointer(c_ssName))
+
+	snapPathParts := strings.SplitN(snapViewPath, "/", 4)
+
+	c_svCluster := C.CString(snapPathParts[0])
+	defer C.free(unsafe.Pointer(c_svCluster))
+
+	c_svTenant := C.CString(snapPathParts[1])
+	defer C.free(unsafe.Pointer(c_svTenant))
+
+	c_svBucket := C.CString(snapPathParts[2])
+	defer C.free(unsafe.Pointer(c_svBucket))
+
+	c_svObject := C.CString(snapPathParts[3])
+	defer C.free(unsafe.Pointer(c_svObject))
+
+	snapshotObjectPath := strings.SplitN(strings.Split(snapshot, "@")[0], "/", 4)
+
+	c_ssCluster := C.CString(snapshotObjectPath[0])
+	defer C.free(unsafe.Pointer(c_ssCluster))
+
+	c_ssTenant := C.CString(snapshotObjectPath[1])
+	defer C.free(unsafe.Pointer(c_ssTenant))
+
+	// Libccow Init
+	conf, err := efsutil.GetLibccowConf()
+	if err != nil {
+		return err
+	}
+
+	c_conf := C.CString(string(conf))
+	defer C.free(unsafe.Pointer(c_conf))
+
+	//SnapView ccow_t
+	var svtc C.ccow_t
+	ret := C.ccow_tenant_init(c_conf, c_svCluster, C.strlen(c_svCluster)+1,
+		c_svTenant, C.strlen(c_svTenant)+1, &svtc)
+	if ret != 0 {
+		return fmt.Errorf("%s: snapView ccow_tenant_init err=%d", efsutil.GetFUNC(), ret)
+	}
+	defer C.ccow_tenant_term(svtc)
+
+	var snapview_t C.ccow_snapview_t
+	ret = C.ccow_snapview_create(svtc, &snapview_t, c_svBucket, C.strlen(c_svBucket)+1, c_svObject, C.strlen(c_svObject)+1)
+	if ret != 0 && ret != -C.EEXIST {
+		return fmt.Errorf("%s: snapView ccow_snapview_create err=%d", efsutil.GetFUNC(), ret)
+	}
+	defer C.ccow_snapview_destroy(svtc, snapview_t)
+
+	//Snapshot ccow_t
+	var sstc C.ccow_t
+	ret = C.ccow_tenant_init(c_conf, c_ssCluster, C.strlen(c_ssCluster)+1,
+		c_ssTenant, C.strlen(c_ssTenant)+1, &sstc)
+	if ret != 0 {
+		return fmt.Errorf("%s: snapshot ccow_tenant_init err=%d", efsutil.GetFUNC(), ret)
+	}
+	defer C.ccow_tenant_term(sstc)
+
+	ret = C.ccow_snapshot_rollback(sstc, snapview_t, c_ssName, C.strlen(c_ssName)+1)
+	if ret != 0 {
+		if ret == -C.ENOENT {
+			return fmt.Errorf("Snapshot %s not exists in the snapview %s", snapshot, snapViewPath)
+		}
+		return fmt.Errorf("%s: ccow_snapshot_rollback err=%d", efsutil.GetFUNC(), ret)
+	}
+
+	return nil
+}
+
+// SnapshotRestore replaces target with the content of a snapshot, the
+// snapshot source is rolled back in place when target is empty
+func SnapshotRestore(snapViewPath string, snapshot string, target string) error {
+	source := strings.Split(snapshot, "@")[0]
+	if target == "" || target == source {
+		return snapshotRollbackInPlace(snapViewPath, snapshot)
+	}
+
+	t := strings.SplitN(target, "/", 4)
+	_, err := efsutil.GetMDKey(t[0], t[1], t[2], t[3], "ccow-logical-size")
+	if err == nil {
+		err = efsutil.ObjectDelete(t[0], t[1], t[2], t[3])
+		if err != nil {
+			return err
+		}
+	}
+	return snapshotClone(snapViewPath, snapshot, target, nil)
+}
+
+// ServedLuns returns iSCSI services exporting the object as a LUN
+func ServedLuns(opath string) ([]efsutil.ServiceEntry, error) {
+	var res []efsutil.ServiceEntry
+
+	entries, err := efsutil.GetServiceEntries("iscsi")
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if efsutil.ServiceObjectPath(e.Type, e.Entry) == opath {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+func snapshotRollback(snapViewPath string, snapshot string, target string, force bool) error {
+	source := strings.Split(snapshot, "@")[0]
+	if target == "" {
+		target = source
+	}
+
+	// the snapshot has to exist before the target is touched
+	snaps, err := GetSnapshots(snapViewPath, snapshot, 1)
+	if err != nil {
+		return err
+	}
+	if len(snaps) == 0 || snaps[0] != snapshot {
+		return fmt.Errorf("Snapshot %s not exists in the snapview %s", snapshot, snapViewPath)
+	}
+
+	luns, err := ServedLuns(target)
+	if err != nil {
+		return err
+	}
+	for _, lun := range luns {
+		fmt.Printf("Warning: %s is served as iSCSI LUN %s by service %s (status %s)\n",
+			target, strings.Split(lun.Entry, "@")[0], lun.Service, lun.Status)
+	}
+	if len(luns) > 0 && !force {
+		return fmt.Errorf("Object %s is in use by iSCSI service, unserve it or use --force", target)
+	}
+
+	t := strings.SplitN(target, "/", 4)
+	_, err = efsutil.GetMDKey(t[0], t[1], t[2], t[3], "ccow-logical-size")
+	if err == nil {
+		safety := target + "@rollback-" + time.Now().UTC().Format(snapScheduleTimeLayout)
+		err = SnapshotAdd(snapViewPath, safety, map[string]string{"rollback-of": snapshot}, nil)
+		if err != nil {
+			return fmt.Errorf("Safety snapshot failed, rollback aborted: %v", err)
+		}
+	}
+
+	err = SnapshotRestore(snapViewPath, snapshot, target)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Object %s has been rolled back to %s\n", target, snapshot)
+	return nil
+}
+
+var (
+	snapshotRollbackTarget string
+	snapshotRollbackForce  bool
+
+	snapshotRollbackCmd = &cobra.Command{
+		Use:   "snapshot-rollback <snapViewPath> <cluster>/<tenant>/<bucket>/<object>@<snapshotName>",
+		Short: "restore an object from a snapshot",
+		Long:  "take a safety snapshot of the current object state and restore the object, or --target, from a snapshot",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("Wrong parameters: Should be 'efscli object snapshot-rollback <snapViewPath> <snapshot>'")
+			}
+			srcPathParts := strings.Split(args[1], "@")
+			if len(srcPathParts) != 2 || len(strings.SplitN(srcPathParts[0], "/", 4)) != 4 {
+				return fmt.Errorf("Wrong object snapshot format %s. Should be <cluster>/<tenant>/<bucket>/<object>@<snapshotName>", args[1])
+			}
+			if snapshotRollbackTarget != "" && len(strings.SplitN(snapshotRollbackTarget, "/", 4)) != 4 {
+				return fmt.Errorf("Wrong target path: %s", snapshotRollbackTarget)
+			}
+			return checkSnapViewPath(args[0])
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			err := snapshotRollback(args[0], args[1], snapshotRollbackTarget, snapshotRollbackForce)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	snapshotRollbackCmd.Flags().StringVarP(&snapshotRollbackTarget, "target", "t", "", "Restore into this object instead of the snapshot source")
+	snapshotRollbackCmd.Flags().BoolVarP(&snapshotRollbackForce, "force", "f", false, "Roll back even if the object is served as iSCSI LUN")
+	ObjectCmd.AddCommand(snapshotRollbackCmd)
+}
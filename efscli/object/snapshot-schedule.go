@@ -0,0 +1,485 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package object
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/spf13/cobra"
+)
+
+const (
+	snapScheduleKeyPrefix  = "X-snapshot-schedule-"
+	snapScheduleTimeLayout = "20060102-150405"
+	snapScheduleTemplate   = "{name}-{time}"
+)
+
+// snapSchedule is kept as JSON in the X-snapshot-schedule-<name> key of
+// the snapview object. Source is either an object path or a prefix
+// terminated with '*'.
+type snapSchedule struct {
+	Name       string `json:"name"`
+	Source     string `json:"source"`
+	Interval   string `json:"interval"`
+	Template   string `json:"template"`
+	KeepLast   int    `json:"keep_last"`
+	KeepHourly int    `json:"keep_hourly"`
+	KeepDaily  int    `json:"keep_daily"`
+	KeepWeekly int    `json:"keep_weekly"`
+}
+
+type scheduledSnapshot struct {
+	path string
+	time time.Time
+}
+
+// parseInterval accepts Go durations plus the 'd' and 'w' suffixes
+func parseInterval(s string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+
+	if strings.HasSuffix(s, "d") || strings.HasSuffix(s, "w") {
+		n, e := strconv.Atoi(s[:len(s)-1])
+		if e != nil {
+			return 0, fmt.Errorf("Invalid interval %s", s)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+		if strings.HasSuffix(s, "w") {
+			d *= 7
+		}
+	} else {
+		d, err = time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid interval %s", s)
+		}
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("Interval has to be positive: %s", s)
+	}
+	return d, nil
+}
+
+func checkSnapViewPath(snapViewPath string) error {
+	if len(strings.SplitN(snapViewPath, "/", 4)) != 4 {
+		return fmt.Errorf("Wrong snapview path: %s", snapViewPath)
+	}
+	if !strings.HasSuffix(snapViewPath, EDGEFS_SNAPVIEW_SUFFIX) {
+		return fmt.Errorf("Not a snapview path: %s", snapViewPath)
+	}
+	return nil
+}
+
+func (sched *snapSchedule) validate() error {
+	r, _ := regexp.Compile("^[A-Za-z0-9_.-]+$")
+	if !r.MatchString(sched.Name) {
+		return fmt.Errorf("Invalid schedule name: %s", sched.Name)
+	}
+
+	r, _ = regexp.Compile("^[^/ ]+/[^/ ]+/[^/ ]+/.+$")
+	if !r.MatchString(sched.Source) {
+		return fmt.Errorf("Invalid source %s, should be <cluster>/<tenant>/<bucket>/<object> or <cluster>/<tenant>/<bucket>/<prefix>*",
+			sched.Source)
+	}
+
+	if _, err := parseInterval(sched.Interval); err != nil {
+		return err
+	}
+
+	// {name} keeps schedules sharing a snapview from pruning each other
+	if strings.Count(sched.Template, "{time}") != 1 || strings.Count(sched.Template, "{name}") != 1 ||
+		strings.ContainsAny(sched.Template, "/@ ") {
+		return fmt.Errorf("Invalid name template %s, it has to contain {name} and {time} once and no '/', '@' or spaces",
+			sched.Template)
+	}
+
+	if sched.KeepLast < 0 || sched.KeepHourly < 0 || sched.KeepDaily < 0 || sched.KeepWeekly < 0 {
+		return fmt.Errorf("Retention counts cannot be negative")
+	}
+	return nil
+}
+
+func (sched *snapSchedule) snapshotName(t time.Time) string {
+	n := strings.Replace(sched.Template, "{name}", sched.Name, -1)
+	return strings.Replace(n, "{time}", t.UTC().Format(snapScheduleTimeLayout), -1)
+}
+
+// matcher recognizes snapshots of object created by this schedule and
+// extracts their creation time from the name
+func (sched *snapSchedule) matcher(object string) *regexp.Regexp {
+	t := strings.Replace(sched.Template, "{name}", sched.Name, -1)
+	parts := strings.SplitN(t, "{time}", 2)
+	return regexp.MustCompile("^" + regexp.QuoteMeta(object+"@"+parts[0]) +
+		"([0-9]{8}-[0-9]{6})" + regexp.QuoteMeta(parts[1]) + "$")
+}
+
+// objects resolves the schedule source into the list of object paths
+func (sched *snapSchedule) objects() ([]string, error) {
+	if !strings.HasSuffix(sched.Source, "*") {
+		return []string{sched.Source}, nil
+	}
+
+	s := strings.SplitN(strings.TrimSuffix(sched.Source, "*"), "/", 4)
+	entries, err := efsutil.ListObjects(s[0], s[1], s[2], s[3])
+	if err != nil {
+		return nil, err
+	}
+
+	var res []string
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name, EDGEFS_SNAPVIEW_SUFFIX) {
+			continue
+		}
+		res = append(res, s[0]+"/"+s[1]+"/"+s[2]+"/"+e.Name)
+	}
+	return res, nil
+}
+
+// retained returns the snapshots to keep. snaps has to be sorted newest
+// first. Without any rule every snapshot is kept.
+func (sched *snapSchedule) retained(snaps []scheduledSnapshot) map[string]bool {
+	keep := make(map[string]bool)
+
+	if sched.KeepLast == 0 && sched.KeepHourly == 0 && sched.KeepDaily == 0 && sched.KeepWeekly == 0 {
+		for _, ss := range snaps {
+			keep[ss.path] = true
+		}
+		return keep
+	}
+
+	for i := 0; i < len(snaps) && i < sched.KeepLast; i++ {
+		keep[snaps[i].path] = true
+	}
+
+	periods := []struct {
+		count  int
+		period func(t time.Time) string
+	}{
+		{sched.KeepHourly, func(t time.Time) string { return t.Format("2006010215") }},
+		{sched.KeepDaily, func(t time.Time) string { return t.Format("20060102") }},
+		{sched.KeepWeekly, func(t time.Time) string {
+			y, w := t.ISOWeek()
+			return fmt.Sprintf("%d-%d", y, w)
+		}},
+	}
+
+	for _, p := range periods {
+		seen := make(map[string]bool)
+		for _, ss := range snaps {
+			if len(seen) >= p.count {
+				break
+			}
+			key := p.period(ss.time)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			keep[ss.path] = true
+		}
+	}
+	return keep
+}
+
+func getSnapSchedules(snapViewPath string) ([]snapSchedule, error) {
+	s := strings.SplitN(snapViewPath, "/", 4)
+
+	md, err := efsutil.GetMDPat(s[0], s[1], s[2], s[3], snapScheduleKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []snapSchedule
+	for k, v := range md {
+		var sched snapSchedule
+		if err := json.Unmarshal([]byte(v), &sched); err != nil {
+			return nil, fmt.Errorf("Schedule %s decoding error: %v", k, err)
+		}
+		res = append(res, sched)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+func snapScheduleAdd(snapViewPath string, sched snapSchedule) error {
+	err := sched.validate()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(sched)
+	if err != nil {
+		return err
+	}
+
+	s := strings.SplitN(snapViewPath, "/", 4)
+	err = efsutil.UpdateMD(s[0], s[1], s[2], s[3], snapScheduleKeyPrefix+sched.Name, string(data))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Snapshot schedule %s has been set on %s\n", sched.Name, snapViewPath)
+	return nil
+}
+
+func snapScheduleRm(snapViewPath string, name string) error {
+	s := strings.SplitN(snapViewPath, "/", 4)
+
+	_, err := efsutil.GetMDKey(s[0], s[1], s[2], s[3], snapScheduleKeyPrefix+name)
+	if err != nil {
+		return fmt.Errorf("Snapshot schedule %s not found in %s", name, snapViewPath)
+	}
+
+	err = efsutil.UpdateMDMany(s[0], s[1], s[2], s[3],
+		[]efsutil.KeyValue{{Key: snapScheduleKeyPrefix + name, Value: ""}})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Snapshot schedule %s has been removed from %s\n", name, snapViewPath)
+	return nil
+}
+
+func snapScheduleList(snapViewPath string) error {
+	schedules, err := getSnapSchedules(snapViewPath)
+	if err != nil {
+		return err
+	}
+
+	for _, sched := range schedules {
+		fmt.Printf("%s: source=%s interval=%s template=%s keep-last=%d keep-hourly=%d keep-daily=%d keep-weekly=%d\n",
+			sched.Name, sched.Source, sched.Interval, sched.Template,
+			sched.KeepLast, sched.KeepHourly, sched.KeepDaily, sched.KeepWeekly)
+	}
+	return nil
+}
+
+// snapScheduleRunOnce creates the snapshots which are due and prunes the
+// expired ones for every schedule of the snapview
+func snapScheduleRunOnce(snapViewPath string, dryRun bool) error {
+	schedules, err := getSnapSchedules(snapViewPath)
+	if err != nil {
+		return err
+	}
+
+	existing, err := GetSnapshots(snapViewPath, "", 1000000)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	var failed int
+
+	for i := range schedules {
+		sched := &schedules[i]
+
+		interval, err := parseInterval(sched.Interval)
+		if err != nil {
+			fmt.Printf("ERROR: schedule %s: %v\n", sched.Name, err)
+			failed++
+			continue
+		}
+
+		objects, err := sched.objects()
+		if err != nil {
+			fmt.Printf("ERROR: schedule %s: %v\n", sched.Name, err)
+			failed++
+			continue
+		}
+
+		for _, object := range objects {
+			var snaps []scheduledSnapshot
+			r := sched.matcher(object)
+			for _, ss := range existing {
+				m := r.FindStringSubmatch(ss)
+				if m == nil {
+					continue
+				}
+				t, err := time.Parse(snapScheduleTimeLayout, m[1])
+				if err != nil {
+					continue
+				}
+				snaps = append(snaps, scheduledSnapshot{path: ss, time: t})
+			}
+			sort.Slice(snaps, func(i, j int) bool { return snaps[i].time.After(snaps[j].time) })
+
+			if len(snaps) == 0 || now.Sub(snaps[0].time) >= interval {
+				ss := scheduledSnapshot{path: object + "@" + sched.snapshotName(now), time: now}
+				if dryRun {
+					fmt.Printf("Would add snapshot %s\n", ss.path)
+				} else if err := SnapshotAdd(snapViewPath, ss.path, map[string]string{"schedule": sched.Name}, nil); err != nil {
+					fmt.Printf("ERROR: schedule %s: %v\n", sched.Name, err)
+					failed++
+					continue
+				}
+				snaps = append([]scheduledSnapshot{ss}, snaps...)
+			}
+
+			keep := sched.retained(snaps)
+			for _, ss := range snaps {
+				if keep[ss.path] {
+					continue
+				}
+				if dryRun {
+					fmt.Printf("Would remove snapshot %s\n", ss.path)
+				} else if err := SnapshotRm(snapViewPath, ss.path, nil); err != nil {
+					fmt.Printf("ERROR: schedule %s: %v\n", sched.Name, err)
+					failed++
+				}
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d snapshot schedule operation(s) failed", failed)
+	}
+	return nil
+}
+
+func snapScheduleRun(snapViewPath string, once bool, checkInterval string, dryRun bool) error {
+	if once {
+		return snapScheduleRunOnce(snapViewPath, dryRun)
+	}
+
+	d, err := parseInterval(checkInterval)
+	if err != nil {
+		return err
+	}
+
+	for {
+		err := snapScheduleRunOnce(snapViewPath, dryRun)
+		if err != nil {
+			fmt.Printf("ERROR: %v\n", err)
+		}
+		time.Sleep(d)
+	}
+}
+
+func snapViewArgs(n int, usage string) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if len(args) != n {
+			return fmt.Errorf("Wrong parameters: Should be 'efscli object snapshot-schedule %s'", usage)
+		}
+		return checkSnapViewPath(args[0])
+	}
+}
+
+var (
+	snapScheduleFlags  snapSchedule
+	snapScheduleOnce   bool
+	snapScheduleDryRun bool
+	snapScheduleCheck  string
+
+	snapScheduleCmd = &cobra.Command{
+		Use:   "snapshot-schedule",
+		Short: "snapshot schedules of a snapview object",
+		Long:  "periodic snapshots with retention rules, stored in a snapview object",
+	}
+
+	snapScheduleAddCmd = &cobra.Command{
+		Use:   "add <snapViewPath> <name> <cluster>/<tenant>/<bucket>/<object>|<prefix>*",
+		Short: "add or replace a snapshot schedule",
+		Long:  "add or replace a snapshot schedule for an object or for all objects matching a prefix",
+		Args:  snapViewArgs(3, "add <snapViewPath> <name> <source>"),
+		Run: func(cmd *cobra.Command, args []string) {
+			sched := snapScheduleFlags
+			sched.Name = args[1]
+			sched.Source = args[2]
+			err := snapScheduleAdd(args[0], sched)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	snapScheduleRmCmd = &cobra.Command{
+		Use:   "rm <snapViewPath> <name>",
+		Short: "remove a snapshot schedule",
+		Long:  "remove a snapshot schedule, snapshots it created are kept",
+		Args:  snapViewArgs(2, "rm <snapViewPath> <name>"),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := snapScheduleRm(args[0], args[1])
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	snapScheduleListCmd = &cobra.Command{
+		Use:   "list <snapViewPath>",
+		Short: "list snapshot schedules",
+		Long:  "list snapshot schedules of a snapview object",
+		Args:  snapViewArgs(1, "list <snapViewPath>"),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := snapScheduleList(args[0])
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	snapScheduleRunCmd = &cobra.Command{
+		Use:   "run <snapViewPath>",
+		Short: "create due snapshots and prune expired ones",
+		Long:  "create due snapshots and prune expired ones, either in a loop or once (e.g. from cron)",
+		Args:  snapViewArgs(1, "run <snapViewPath>"),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := snapScheduleRun(args[0], snapScheduleOnce, snapScheduleCheck, snapScheduleDryRun)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	snapScheduleAddCmd.Flags().StringVarP(&snapScheduleFlags.Interval, "interval", "i", "1h", "Interval between snapshots, e.g. 30m, 1h, 1d, 1w")
+	snapScheduleAddCmd.Flags().StringVarP(&snapScheduleFlags.Template, "template", "t", snapScheduleTemplate, "Snapshot name template, {name} is the schedule name, {time} the UTC creation time, both are required")
+	snapScheduleAddCmd.Flags().IntVarP(&snapScheduleFlags.KeepLast, "keep-last", "", 0, "Keep the last N snapshots")
+	snapScheduleAddCmd.Flags().IntVarP(&snapScheduleFlags.KeepHourly, "keep-hourly", "", 0, "Keep the newest snapshot of each of the last N hours")
+	snapScheduleAddCmd.Flags().IntVarP(&snapScheduleFlags.KeepDaily, "keep-daily", "", 0, "Keep the newest snapshot of each of the last N days")
+	snapScheduleAddCmd.Flags().IntVarP(&snapScheduleFlags.KeepWeekly, "keep-weekly", "", 0, "Keep the newest snapshot of each of the last N weeks")
+
+	snapScheduleRunCmd.Flags().BoolVarP(&snapScheduleOnce, "once", "", false, "Run a single pass and exit")
+	snapScheduleRunCmd.Flags().StringVarP(&snapScheduleCheck, "check-interval", "", "1m", "Pause between passes of the run loop")
+	snapScheduleRunCmd.Flags().BoolVarP(&snapScheduleDryRun, "dry-run", "", false, "Only print what would be done")
+
+	snapScheduleCmd.AddCommand(snapScheduleAddCmd)
+	snapScheduleCmd.AddCommand(snapScheduleRmCmd)
+	snapScheduleCmd.AddCommand(snapScheduleListCmd)
+	snapScheduleCmd.AddCommand(snapScheduleRunCmd)
+	ObjectCmd.AddCommand(snapScheduleCmd)
+}
@@ -0,0 +1,228 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package object
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/spf13/cobra"
+)
+
+const (
+	SnapMetaKeyPrefix = "X-snapshot-meta-"
+)
+
+// SnapshotMeta is recorded by snapshot-add in the X-snapshot-meta-<snapshot>
+// key of the snapview object. Snapshots added by older versions have none.
+type SnapshotMeta struct {
+	Name       string            `json:"name"`
+	Source     string            `json:"source"`
+	Generation uint64            `json:"generation"`
+	Created    int64             `json:"created"`
+	Size       uint64            `json:"size"`
+	Tags       map[string]string `json:"tags,omitempty"`
+}
+
+func parseSnapshotTags(tags []string) (map[string]string, error) {
+	res := make(map[string]string)
+	for _, t := range tags {
+		kv := strings.SplitN(t, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("Wrong tag format %s, expecting key=value", t)
+		}
+		res[kv[0]] = kv[1]
+	}
+	return res, nil
+}
+
+func snapshotSaveMeta(snapViewPath string, meta SnapshotMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	s := strings.SplitN(snapViewPath, "/", 4)
+	return efsutil.UpdateMD(s[0], s[1], s[2], s[3], SnapMetaKeyPrefix+meta.Name, string(data))
+}
+
+func snapshotDropMeta(snapViewPath string, snapshot string) error {
+	s := strings.SplitN(snapViewPath, "/", 4)
+	return efsutil.UpdateMDMany(s[0], s[1], s[2], s[3],
+		[]efsutil.KeyValue{{Key: SnapMetaKeyPrefix + snapshot, Value: ""}})
+}
+
+// snapshotSourceMeta captures generation and size of the source object
+// at the time of the snapshot
+func snapshotSourceMeta(snapshot string, tags map[string]string) SnapshotMeta {
+	meta := SnapshotMeta{
+		Name:    snapshot,
+		Source:  strings.Split(snapshot, "@")[0],
+		Created: time.Now().Unix(),
+		Tags:    tags,
+	}
+
+	s := strings.SplitN(meta.Source, "/", 4)
+	md, err := efsutil.GetMDPat(s[0], s[1], s[2], s[3], "ccow-")
+	if err != nil {
+		return meta
+	}
+	meta.Generation, _ = strconv.ParseUint(md["ccow-tx-generation-id"], 10, 64)
+	meta.Size, _ = strconv.ParseUint(md["ccow-logical-size"], 10, 64)
+	return meta
+}
+
+// GetSnapshotsMeta returns the snapshots of a snapview with their recorded
+// metadata, those without it only carry the name and source
+func GetSnapshotsMeta(snapViewPath string, pattern string) ([]SnapshotMeta, error) {
+	snapshots, err := GetSnapshots(snapViewPath, pattern, 1000000)
+	if err != nil {
+		return nil, err
+	}
+
+	s := strings.SplitN(snapViewPath, "/", 4)
+	md, err := efsutil.GetMDPat(s[0], s[1], s[2], s[3], SnapMetaKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []SnapshotMeta
+	for _, ss := range snapshots {
+		meta := SnapshotMeta{Name: ss, Source: strings.Split(ss, "@")[0]}
+		if v, ok := md[SnapMetaKeyPrefix+ss]; ok {
+			json.Unmarshal([]byte(v), &meta)
+		}
+		res = append(res, meta)
+	}
+	return res, nil
+}
+
+func sortSnapshotsMeta(snaps []SnapshotMeta, by string, reverse bool) error {
+	var less func(i, j int) bool
+	switch by {
+	case "name":
+		less = func(i, j int) bool { return snaps[i].Name < snaps[j].Name }
+	case "created":
+		less = func(i, j int) bool { return snaps[i].Created < snaps[j].Created }
+	case "size":
+		less = func(i, j int) bool { return snaps[i].Size < snaps[j].Size }
+	case "generation":
+		less = func(i, j int) bool { return snaps[i].Generation < snaps[j].Generation }
+	default:
+		return fmt.Errorf("Unknown sort key %s, expecting name, created, size or generation", by)
+	}
+
+	if reverse {
+		sort.SliceStable(snaps, func(i, j int) bool { return less(j, i) })
+	} else {
+		sort.SliceStable(snaps, less)
+	}
+	return nil
+}
+
+func formatSnapshotCreated(created int64) string {
+	if created == 0 {
+		return "-"
+	}
+	return time.Unix(created, 0).Format(time.RFC3339)
+}
+
+func formatSnapshotTags(tags map[string]string) string {
+	var res []string
+	for k, v := range tags {
+		res = append(res, k+"="+v)
+	}
+	sort.Strings(res)
+	return strings.Join(res, ",")
+}
+
+func snapshotShow(snapViewPath string, snapshot string, output string) error {
+	snaps, err := GetSnapshotsMeta(snapViewPath, snapshot)
+	if err != nil {
+		return err
+	}
+
+	for _, meta := range snaps {
+		if meta.Name != snapshot {
+			continue
+		}
+
+		if output == "json" {
+			data, err := json.MarshalIndent(meta, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s\n", data)
+			return nil
+		}
+
+		fmt.Printf("Snapshot:   %s\n", meta.Name)
+		fmt.Printf("Snapview:   %s\n", snapViewPath)
+		fmt.Printf("Source:     %s\n", meta.Source)
+		fmt.Printf("Generation: %d\n", meta.Generation)
+		fmt.Printf("Created:    %s\n", formatSnapshotCreated(meta.Created))
+		fmt.Printf("Size:       %d\n", meta.Size)
+		fmt.Printf("Tags:       %s\n", formatSnapshotTags(meta.Tags))
+		return nil
+	}
+
+	return fmt.Errorf("Snapshot %s not found in %s", snapshot, snapViewPath)
+}
+
+var (
+	snapshotShowOutput string
+
+	snapshotShowCmd = &cobra.Command{
+		Use:   "snapshot-show <snapViewPath> <cluster>/<tenant>/<bucket>/<object>@<snapshotName>",
+		Short: "show snapshot details",
+		Long:  "show source, generation, creation time, size and tags of a snapshot",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("Wrong parameters: Should be 'efscli object snapshot-show <snapViewPath> <snapshot>'")
+			}
+			if len(strings.Split(args[1], "@")) != 2 {
+				return fmt.Errorf("Wrong object snapshot format %s. Should be <cluster>/<tenant>/<bucket>/<object>@<snapshotName>", args[1])
+			}
+			return checkSnapViewPath(args[0])
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			err := snapshotShow(args[0], args[1], snapshotShowOutput)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	snapshotShowCmd.Flags().StringVarP(&snapshotShowOutput, "output", "o", "", "Output format: json")
+	ObjectCmd.AddCommand(snapshotShowCmd)
+}
@@ -44,7 +44,7 @@ const (
 	EDGEFS_SNAPVIEW_SUFFIX = ".snapview"
 )
 
-func snapViewCreate(opath string, flags []efsutil.FlagValue) error {
+func SnapViewCreate(opath string, flags []efsutil.FlagValue) error {
 
 	c_opath := C.CString(opath)
 	defer C.free(unsafe.Pointer(c_opath))
@@ -122,7 +122,7 @@ var (
 				return
 			}
 
-			err := snapViewCreate(args[0], flagsSnapViewCreate)
+			err := SnapViewCreate(args[0], flagsSnapViewCreate)
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
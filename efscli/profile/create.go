@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package profile
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/sabbot/module/efscli/validate"
+	"github.com/spf13/cobra"
+)
+
+func ProfileCreate(name string, flags []efsutil.FlagValue) error {
+	r, _ := regexp.Compile("^[A-Za-z0-9_.-]+$")
+	if !r.MatchString(name) {
+		return fmt.Errorf("Invalid profile name: %s", name)
+	}
+
+	e := validate.Flags(flags)
+	if e != nil {
+		return e
+	}
+
+	p := make(efsutil.Profile)
+	for i := 0; i < len(flags); i++ {
+		if flags[i].Value != "" {
+			p[flagNames[i]] = flags[i].Value
+		}
+	}
+	if len(p) == 0 {
+		return fmt.Errorf("Profile %s has no attributes", name)
+	}
+
+	err := efsutil.SaveProfile(name, p)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Profile %s: %s\n", name, p.String())
+	return nil
+}
+
+var (
+	flags []efsutil.FlagValue
+
+	createCmd = &cobra.Command{
+		Use:   "create <name>",
+		Short: "create or replace an attribute profile",
+		Long:  "create or replace a named set of bucket and tenant create attributes",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := ProfileCreate(args[0], flags)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	flags = make([]efsutil.FlagValue, len(flagNames))
+	efsutil.ReadAttributes(createCmd, flagNames, flags)
+	ProfileCmd.AddCommand(createCmd)
+}
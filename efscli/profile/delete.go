@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package profile
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/spf13/cobra"
+)
+
+func ProfileDelete(name string) error {
+	err := efsutil.DeleteProfile(name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Profile %s has been deleted\n", name)
+	return nil
+}
+
+var (
+	deleteCmd = &cobra.Command{
+		Use:   "delete <name>",
+		Short: "delete an attribute profile",
+		Long:  "delete an attribute profile, buckets and tenants created with it are not affected",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := ProfileDelete(args[0])
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	ProfileCmd.AddCommand(deleteCmd)
+}
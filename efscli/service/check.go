@@ -0,0 +1,363 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package service
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/sabbot/module/efscli/validate"
+	"github.com/spf13/cobra"
+)
+
+// Nagios plugin exit codes
+const (
+	CheckOK       = 0
+	CheckWarning  = 1
+	CheckCritical = 2
+	CheckUnknown  = 3
+)
+
+const (
+	nfsPort   = "2049"
+	iscsiPort = "3260"
+
+	nfsProgram = 100003
+	nfsVersion = 3
+)
+
+var checkStates = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// checkSeverity orders states for the overall result, UNKNOWN ranks
+// between WARNING and CRITICAL
+var checkSeverity = []int{0, 1, 3, 2}
+
+type CheckResult struct {
+	Server  string
+	Address string
+	Check   string
+	State   int
+	Detail  string
+}
+
+type checkOptions struct {
+	timeout  time.Duration
+	warnDays int
+	critDays int
+}
+
+// serverAddresses maps server ids to addresses, as reported by the
+// running service or, failing that, by the FlexHash table
+func serverAddresses(md map[string]string) map[string]string {
+	res := make(map[string]string)
+
+	j, err := efsutil.GetFlexhashJson()
+	if err == nil {
+		var fh struct {
+			Serverlist []struct {
+				Serverid string `json:"serverid"`
+				Ipaddr   string `json:"ipaddr"`
+			} `json:"serverlist"`
+		}
+		if json.Unmarshal(j, &fh) == nil {
+			for _, s := range fh.Serverlist {
+				if s.Ipaddr != "" {
+					res[s.Serverid] = s.Ipaddr
+				}
+			}
+		}
+	}
+
+	for k, v := range md {
+		if strings.HasPrefix(k, "X-Container-Hostname-") && v != "" && v != "-" {
+			res[strings.TrimPrefix(k, "X-Container-Hostname-")] = v
+		}
+	}
+	return res
+}
+
+func probeTCP(addr string, port string, opts checkOptions) (int, string) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(addr, port), opts.timeout)
+	if err != nil {
+		return CheckCritical, err.Error()
+	}
+	conn.Close()
+	return CheckOK, "port " + port + " accepts connections"
+}
+
+// probeNFS sends an RPC NULL call to the NFS program, any well formed
+// reply tells the server is answering
+func probeNFS(addr string, opts checkOptions) (int, string) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(addr, nfsPort), opts.timeout)
+	if err != nil {
+		return CheckCritical, err.Error()
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(opts.timeout))
+
+	xid := uint32(time.Now().UnixNano())
+	call := make([]byte, 44)
+	binary.BigEndian.PutUint32(call[0:], 0x80000000|40) // last fragment, 40 bytes
+	binary.BigEndian.PutUint32(call[4:], xid)
+	binary.BigEndian.PutUint32(call[8:], 0)  // CALL
+	binary.BigEndian.PutUint32(call[12:], 2) // RPC version
+	binary.BigEndian.PutUint32(call[16:], nfsProgram)
+	binary.BigEndian.PutUint32(call[20:], nfsVersion)
+	// procedure 0 (NULL), AUTH_NULL credentials and verifier stay zero
+
+	_, err = conn.Write(call)
+	if err != nil {
+		return CheckCritical, err.Error()
+	}
+
+	reply := make([]byte, 28)
+	_, err = io.ReadFull(conn, reply)
+	if err != nil {
+		return CheckCritical, fmt.Sprintf("no RPC reply: %v", err)
+	}
+	if binary.BigEndian.Uint32(reply[4:]) != xid || binary.BigEndian.Uint32(reply[8:]) != 1 {
+		return CheckCritical, "malformed RPC reply"
+	}
+	if binary.BigEndian.Uint32(reply[12:]) != 0 {
+		return CheckCritical, "RPC call denied"
+	}
+
+	// verifier body is empty for AUTH_NULL, accept_stat follows
+	switch binary.BigEndian.Uint32(reply[24:]) {
+	case 0:
+		return CheckOK, "RPC NULL call answered"
+	case 2:
+		return CheckOK, fmt.Sprintf("RPC answered, NFSv%d not supported", nfsVersion)
+	default:
+		return CheckWarning, fmt.Sprintf("RPC NULL call failed, accept_stat=%d", binary.BigEndian.Uint32(reply[24:]))
+	}
+}
+
+func probeHTTP(addr string, port string, opts checkOptions) (int, string) {
+	client := &http.Client{Timeout: opts.timeout}
+	resp, err := client.Get("http://" + net.JoinHostPort(addr, port) + "/")
+	if err != nil {
+		return CheckCritical, err.Error()
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return CheckWarning, "HTTP " + resp.Status
+	}
+	return CheckOK, "HTTP " + resp.Status
+}
+
+// probeHTTPS checks that the TLS port answers and how long the
+// certificate is valid, the chain is not verified as servers are
+// addressed by IP
+func probeHTTPS(addr string, port string, opts checkOptions) (int, string) {
+	client := &http.Client{
+		Timeout: opts.timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	resp, err := client.Get("https://" + net.JoinHostPort(addr, port) + "/")
+	if err != nil {
+		return CheckCritical, err.Error()
+	}
+	resp.Body.Close()
+
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		return CheckWarning, "HTTPS " + resp.Status + ", no certificate"
+	}
+
+	cert := resp.TLS.PeerCertificates[0]
+	name := "certificate"
+	if cert.Subject.CommonName != "" {
+		name += " " + cert.Subject.CommonName
+	}
+	left := time.Until(cert.NotAfter)
+	days := int(left.Hours() / 24)
+	detail := fmt.Sprintf("HTTPS %s, %s expires %s",
+		resp.Status, name, cert.NotAfter.Format("2006-01-02"))
+
+	switch {
+	case left <= 0:
+		return CheckCritical, fmt.Sprintf("HTTPS %s, %s expired %s",
+			resp.Status, name, cert.NotAfter.Format("2006-01-02"))
+	case time.Now().Before(cert.NotBefore):
+		return CheckCritical, fmt.Sprintf("HTTPS %s, %s not valid before %s",
+			resp.Status, name, cert.NotBefore.Format("2006-01-02"))
+	case days < opts.critDays:
+		return CheckCritical, detail
+	case days < opts.warnDays:
+		return CheckWarning, detail
+	}
+	if resp.StatusCode >= 500 {
+		return CheckWarning, detail
+	}
+	return CheckOK, detail
+}
+
+// checkServer runs the probes matching the service type against a server
+func checkServer(md map[string]string, server string, addr string, opts checkOptions) []CheckResult {
+	var res []CheckResult
+	add := func(check string, state int, detail string) {
+		res = append(res, CheckResult{Server: server, Address: addr, Check: check,
+			State: state, Detail: detail})
+	}
+
+	if addr == "" {
+		add("address", CheckUnknown, "address of the server is not known")
+		return res
+	}
+
+	stype := md["X-Service-Type"]
+	switch stype {
+	case "s3", "s3s", "s3x", "swift":
+		if p := md["X-HTTP-Port"]; p != "" && p != "-" {
+			state, detail := probeHTTP(addr, p, opts)
+			add("http:"+p, state, detail)
+		}
+		if p := md["X-HTTPS-Port"]; p != "" && p != "-" && md["X-HTTPS-Cert"] != "-" {
+			state, detail := probeHTTPS(addr, p, opts)
+			add("https:"+p, state, detail)
+		}
+	case "nfs":
+		state, detail := probeNFS(addr, opts)
+		add("nfs:"+nfsPort, state, detail)
+	case "iscsi":
+		state, detail := probeTCP(addr, iscsiPort, opts)
+		add("iscsi:"+iscsiPort, state, detail)
+	case "isgw":
+		local := md["X-ISGW-Local"]
+		if _, p, err := net.SplitHostPort(local); err == nil {
+			state, detail := probeTCP(addr, p, opts)
+			add("isgw:"+p, state, detail)
+		} else {
+			add("isgw", CheckUnknown, "X-ISGW-Local does not name a port")
+		}
+	default:
+		add("type", CheckUnknown, "no check for service type "+stype)
+	}
+	return res
+}
+
+func worstState(results []CheckResult) int {
+	worst := CheckOK
+	for _, r := range results {
+		if checkSeverity[r.State] > checkSeverity[worst] {
+			worst = r.State
+		}
+	}
+	return worst
+}
+
+// ServiceCheck probes every server of the service and returns the
+// Nagios exit code. The first line of the output is the status summary.
+func ServiceCheck(sname string, opts checkOptions) int {
+	md, err := efsutil.GetMDPat("", "svcs", sname, "", "X-")
+	if err != nil {
+		fmt.Printf("%s UNKNOWN - %v\n", sname, err)
+		return CheckUnknown
+	}
+
+	if md["X-Status"] != "enabled" {
+		fmt.Printf("%s WARNING - service is %s\n", sname, md["X-Status"])
+		return CheckWarning
+	}
+
+	var servers []string
+	for _, s := range strings.Split(md["X-Servers"], ",") {
+		if s = strings.TrimSpace(s); s != "" && s != "-" {
+			servers = append(servers, s)
+		}
+	}
+	if len(servers) == 0 {
+		fmt.Printf("%s UNKNOWN - service is not assigned to any server\n", sname)
+		return CheckUnknown
+	}
+
+	addrs := serverAddresses(md)
+	var results []CheckResult
+	for _, s := range servers {
+		results = append(results, checkServer(md, s, addrs[s], opts)...)
+	}
+
+	worst := worstState(results)
+	failed := 0
+	for _, r := range results {
+		if r.State != CheckOK {
+			failed++
+		}
+	}
+	fmt.Printf("%s %s - %d of %d check(s) on %d server(s) not OK\n", sname,
+		checkStates[worst], failed, len(results), len(servers))
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	table.SetHeader([]string{"Server", "Address", "Check", "State", "Detail"})
+	for _, r := range results {
+		table.Append([]string{r.Server, r.Address, r.Check, checkStates[r.State], r.Detail})
+	}
+	table.Render()
+
+	return worst
+}
+
+var (
+	checkOpts checkOptions
+
+	checkCmd = &cobra.Command{
+		Use:   "check <service name>",
+		Short: "probe servers of a service",
+		Long: `probe every server the service runs on: HTTP and HTTPS ports of S3 and
+Swift services including validity of the TLS certificate, an RPC call to
+NFS servers, the login port of iSCSI targets. Exit codes follow Nagios
+plugins: 0 OK, 1 WARNING, 2 CRITICAL, 3 UNKNOWN.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("Requires <service name>")
+			}
+			return validate.Service(cmd, args)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			os.Exit(ServiceCheck(args[0], checkOpts))
+		},
+	}
+)
+
+func init() {
+	checkCmd.Flags().DurationVarP(&checkOpts.timeout, "timeout", "t", 5*time.Second, "Timeout of each probe")
+	checkCmd.Flags().IntVarP(&checkOpts.warnDays, "warn-days", "w", 30, "Warn when the certificate expires within days")
+	checkCmd.Flags().IntVarP(&checkOpts.critDays, "crit-days", "c", 7, "Critical when the certificate expires within days")
+	ServiceCmd.AddCommand(checkCmd)
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package service
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/sabbot/module/efscli/validate"
+	"github.com/spf13/cobra"
+)
+
+// cloneConfig returns the settings turning the config of a freshly created
+// service into the one of src. The clone starts disabled and unassigned,
+// the iSCSI target id stays unique as generated at creation.
+func cloneConfig(src map[string]string, dst map[string]string) map[string]string {
+	skip := func(k string) bool {
+		return !isConfigKey(k) || k == "X-ISCSI-TargetID"
+	}
+
+	settings := make(map[string]string)
+	for k, v := range src {
+		if !skip(k) {
+			settings[k] = v
+		}
+	}
+	for k := range dst {
+		if _, ok := src[k]; !ok && !skip(k) {
+			settings[k] = ""
+		}
+	}
+	settings["X-Servers"] = "-"
+	settings["X-Status"] = "disabled"
+	return settings
+}
+
+// cloneEntry serves an entry of the source service by the clone, NFS
+// exports and iSCSI LUNs get fresh ids, other entries carry none
+func cloneEntry(stype string, dst string, entry string) error {
+	switch stype {
+	case "nfs":
+		return ServiceServeNFS(dst, efsutil.ServiceObjectPath(stype, entry))
+	case "iscsi":
+		return ServiceServeISCSI(dst, efsutil.ServiceObjectPath(stype, entry), "")
+	}
+	fmt.Printf("Serving new %s\n", entry)
+	return efsutil.InsertServiceEntry(dst, entry)
+}
+
+func ServiceClone(src string, dst string, withoutExports bool) error {
+	srcmd, err := efsutil.GetMDPat("", "svcs", src, "", "X-")
+	if err != nil {
+		return fmt.Errorf("Service %s: %v", src, err)
+	}
+	stype := srcmd["X-Service-Type"]
+
+	if efsutil.CheckService(dst) {
+		return fmt.Errorf("Service %s already exists", dst)
+	}
+
+	var entries []string
+	if !withoutExports {
+		entries, err = efsutil.ListKeys("", "svcs", src, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	err = ServiceCreate(stype, dst)
+	if err != nil {
+		return err
+	}
+
+	before, err := efsutil.GetMDPat("", "svcs", dst, "", "X-")
+	if err != nil {
+		return err
+	}
+
+	var par []efsutil.KeyValue
+	for k, v := range cloneConfig(srcmd, before) {
+		if before[k] != v {
+			par = append(par, efsutil.KeyValue{Key: k, Value: v})
+		}
+	}
+	if len(par) > 0 {
+		err = efsutil.UpdateMDMany("", "svcs", dst, "", par)
+		if err != nil {
+			return fmt.Errorf("Service %s config: %v", dst, err)
+		}
+		RecordConfig(dst, before, "clone of "+src)
+	}
+
+	for _, e := range entries {
+		err = cloneEntry(stype, dst, e)
+		if err != nil {
+			return fmt.Errorf("Service %s entry %s: %v", dst, e, err)
+		}
+	}
+
+	fmt.Printf("Service %s cloned from %s with %d entries\n", dst, src, len(entries))
+	return nil
+}
+
+var (
+	cloneWithoutExports bool
+
+	cloneCmd = &cobra.Command{
+		Use:   "clone <source> <name>",
+		Short: "create a new service as a copy of an existing one",
+		Long: `create a new service of the same type and config as the source one,
+disabled and not assigned to any server. Served tenants, buckets, LUNs and
+exports are served by the new service too unless --without-exports is
+given, exports and LUNs get new ids.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("Requires <source> <name>")
+			}
+			err := validate.Service(cmd, args[:1])
+			if err != nil {
+				return err
+			}
+			return validate.Service(cmd, args[1:])
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			err := ServiceClone(args[0], args[1], cloneWithoutExports)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	cloneCmd.Flags().BoolVarP(&cloneWithoutExports, "without-exports", "", false, "Do not serve entries of the source service")
+	ServiceCmd.AddCommand(cloneCmd)
+}
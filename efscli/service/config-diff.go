@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package service
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/sabbot/module/efscli/validate"
+	"github.com/spf13/cobra"
+)
+
+func ConfigDiff(sname string, rev1 string, rev2 string) error {
+	before, err := configRevisionKeys(sname, rev1)
+	if err != nil {
+		return err
+	}
+	after, err := configRevisionKeys(sname, rev2)
+	if err != nil {
+		return err
+	}
+
+	if efsutil.PrintMDDiff(before, after) == 0 {
+		fmt.Printf("Revisions %s and %s of %s are identical\n", rev1, rev2, sname)
+	}
+	return nil
+}
+
+var (
+	configDiffCmd = &cobra.Command{
+		Use:   "diff <service name> <rev1> <rev2>",
+		Short: "compare two config revisions of a service",
+		Long:  "show keys changed between two config revisions, current stands for the live config",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 3 {
+				return fmt.Errorf("Requires <service name> <rev1> <rev2>")
+			}
+			return validate.Service(cmd, args)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			err := ConfigDiff(args[0], args[1], args[2])
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	configCmd.AddCommand(configDiffCmd)
+}
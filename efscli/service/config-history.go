@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package service
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/sabbot/module/efscli/validate"
+	"github.com/spf13/cobra"
+)
+
+func ConfigHistory(sname string) error {
+	revs, err := ConfigRevisions(sname)
+	if err != nil {
+		return err
+	}
+	if len(revs) == 0 {
+		fmt.Printf("Service %s has no config history\n", sname)
+		return nil
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetBorder(false)
+	table.SetHeader([]string{"Rev", "Created", "User", "Action", "Changes"})
+
+	var prev map[string]string
+	for _, rev := range revs {
+		r, err := LoadConfigRevision(sname, rev)
+		if err != nil {
+			return err
+		}
+
+		changes := "-"
+		if prev != nil {
+			changes = strconv.Itoa(configChanges(prev, r.Keys))
+		}
+		prev = r.Keys
+
+		created := time.Unix(r.Created, 0).Format(time.RFC3339)
+		table.Append([]string{strconv.Itoa(r.Rev), created, r.User, r.Action, changes})
+	}
+	table.Render()
+	return nil
+}
+
+var (
+	configHistoryCmd = &cobra.Command{
+		Use:   "history <service name>",
+		Short: "list config revisions of a service",
+		Long:  "list revisions recorded by every config change of a service",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("Requires <service name>")
+			}
+			return validate.Service(cmd, args)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			err := ConfigHistory(args[0])
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	configCmd.AddCommand(configHistoryCmd)
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package service
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/sabbot/module/efscli/validate"
+	"github.com/spf13/cobra"
+)
+
+// ConfigRollback restores the config keys of a revision, keys added since
+// are removed. Name, type and keys maintained by the service are kept.
+func ConfigRollback(sname string, rev int, yes bool) error {
+	r, err := LoadConfigRevision(sname, rev)
+	if err != nil {
+		return err
+	}
+
+	cur, err := efsutil.GetMDPat("", "svcs", sname, "", "X-")
+	if err != nil {
+		return err
+	}
+
+	settings := make(map[string]string)
+	for k, v := range r.Keys {
+		if isConfigKey(k) {
+			settings[k] = v
+		}
+	}
+	for k := range cur {
+		if _, ok := r.Keys[k]; !ok && isConfigKey(k) {
+			settings[k] = ""
+		}
+	}
+
+	// the values have been in effect before, no need to validate them again
+	return ConfigBatch(sname, settings, true, yes, fmt.Sprintf("rollback to %d", rev))
+}
+
+var (
+	configRollbackYes bool
+
+	configRollbackCmd = &cobra.Command{
+		Use:   "rollback <service name> <rev>",
+		Short: "restore a config revision of a service",
+		Long:  "restore config keys of a service as recorded in a revision, the rollback is recorded as a new revision",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("Requires <service name> <rev>")
+			}
+			if _, err := strconv.Atoi(args[1]); err != nil {
+				return fmt.Errorf("Invalid revision %s", args[1])
+			}
+			return validate.Service(cmd, args)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			rev, _ := strconv.Atoi(args[1])
+			err := ConfigRollback(args[0], rev, configRollbackYes)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	configRollbackCmd.Flags().BoolVarP(&configRollbackYes, "yes", "y", false, "Rollback without asking for confirmation")
+	configCmd.AddCommand(configRollbackCmd)
+}
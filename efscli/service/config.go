@@ -31,27 +31,302 @@ import "C"
 import (
 	"github.com/sabbot/module/efscli/efsutil"
 	"github.com/sabbot/module/efscli/validate"
+	"encoding/json"
 	"fmt"
 	"github.com/spf13/cobra"
+	"io/ioutil"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
 )
 
-func Config(sname string, key string, value string) error {
+func Config(sname string, key string, value string, force bool) error {
+	before, err := efsutil.GetMDPat("", "svcs", sname, "", "X-")
+	if err != nil {
+		return err
+	}
+	stype := before["X-Service-Type"]
+
+	err = ValidateConfig(stype, key, value)
+	if err != nil {
+		if !force {
+			return fmt.Errorf("%v, use --force to set it anyway", err)
+		}
+		fmt.Printf("Warning: %v\n", err)
+	}
+
 	ret := efsutil.UpdateMD("", "svcs", sname, "", key, value)
 	if ret != nil {
 		return ret
 	}
+	RecordConfig(sname, before, "set "+key)
 	return efsutil.PrintMDPat("", "svcs", sname, "", "X-")
 }
 
+// ConfigListKeys prints documented keys of the service type with the
+// current values, keys set on the service but not documented follow
+func ConfigListKeys(sname string) error {
+	md, err := efsutil.GetMDPat("", "svcs", sname, "", "X-")
+	if err != nil {
+		return err
+	}
+
+	stype := md["X-Service-Type"]
+	schema, err := ConfigSchema(stype)
+	if err != nil {
+		return err
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	table.SetHeader([]string{"Key", "Allowed", "Default", "Current", "Description"})
+
+	documented := make(map[string]bool)
+	for _, k := range schema {
+		documented[k.Key] = true
+		cur, ok := md[k.Key]
+		if !ok {
+			cur = "-"
+		}
+		desc := k.Desc
+		if k.ReadOnly {
+			desc += " (read-only)"
+		}
+		table.Append([]string{k.Key, k.Allowed(), k.Default, cur, desc})
+	}
+
+	var extra []string
+	for k := range md {
+		if !documented[k] {
+			extra = append(extra, k)
+		}
+	}
+	sort.Strings(extra)
+	for _, k := range extra {
+		table.Append([]string{k, "-", "-", md[k], "undocumented"})
+	}
+
+	fmt.Printf("Service %s, type %s\n\n", sname, stype)
+	table.Render()
+	return nil
+}
+
+// ReadConfigFile reads a flat YAML or JSON map of X- keys to values, a
+// null or empty value removes the key
+func ReadConfigFile(fpath string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	j, err := efsutil.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("Settings %s: %v", fpath, err)
+	}
+
+	var doc map[string]interface{}
+	err = json.Unmarshal(j, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("Settings %s: expecting a map of keys to values", fpath)
+	}
+
+	res := make(map[string]string)
+	for k, v := range doc {
+		if !strings.HasPrefix(k, "X-") {
+			return nil, fmt.Errorf("Settings %s: wrong key %s, expecting X-<key>", fpath, k)
+		}
+		switch t := v.(type) {
+		case string:
+			res[k] = t
+		case float64:
+			res[k] = strconv.FormatFloat(t, 'f', -1, 64)
+		case bool:
+			res[k] = strconv.FormatBool(t)
+		case nil:
+			res[k] = ""
+		default:
+			return nil, fmt.Errorf("Settings %s: value of %s is not a scalar", fpath, k)
+		}
+	}
+	return res, nil
+}
+
+// ParseConfigArgs reads key=value arguments
+func ParseConfigArgs(args []string) (map[string]string, error) {
+	res := make(map[string]string)
+	for _, a := range args {
+		kv := strings.SplitN(a, "=", 2)
+		if len(kv) != 2 || !strings.HasPrefix(kv[0], "X-") {
+			return nil, fmt.Errorf("Wrong setting format %s, expecting X-<key>=<value>", a)
+		}
+		res[kv[0]] = kv[1]
+	}
+	return res, nil
+}
+
+func isRuntimeConfigKey(key string) bool {
+	for _, p := range runtimeConfigPrefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigBatch shows the changes the settings make to the service config,
+// asks for confirmation and stores them at once
+func ConfigBatch(sname string, settings map[string]string, force bool, yes bool, action string) error {
+	before, err := efsutil.GetMDPat("", "svcs", sname, "", "X-")
+	if err != nil {
+		return err
+	}
+	stype := before["X-Service-Type"]
+
+	after := make(map[string]string)
+	for k, v := range before {
+		after[k] = v
+	}
+
+	var par []efsutil.KeyValue
+	var invalid []string
+	for k, v := range settings {
+		cur, exists := before[k]
+		if (v == "" && !exists) || (exists && cur == v) {
+			continue
+		}
+
+		if v != "" {
+			err = ValidateConfig(stype, k, v)
+		} else if !isConfigKey(k) {
+			err = fmt.Errorf("%s cannot be removed", k)
+		} else {
+			err = nil
+		}
+		if err != nil {
+			invalid = append(invalid, err.Error())
+		}
+
+		par = append(par, efsutil.KeyValue{Key: k, Value: v})
+		if v == "" {
+			delete(after, k)
+		} else {
+			after[k] = v
+		}
+	}
+
+	if len(par) == 0 {
+		fmt.Printf("Service %s config is unchanged\n", sname)
+		return nil
+	}
+
+	sort.Strings(invalid)
+	for _, e := range invalid {
+		fmt.Printf("Invalid: %s\n", e)
+	}
+	if len(invalid) > 0 && !force {
+		return fmt.Errorf("%d invalid setting(s), use --force to store them anyway", len(invalid))
+	}
+
+	efsutil.PrintMDDiff(before, after)
+
+	if !yes && !efsutil.AskForConfirmation(fmt.Sprintf("Apply %d change(s) to service %s?", len(par), sname)) {
+		return nil
+	}
+
+	err = efsutil.UpdateMDMany("", "svcs", sname, "", par)
+	if err != nil {
+		return err
+	}
+	RecordConfig(sname, before, action)
+
+	fmt.Printf("Service %s: %d key(s) updated\n", sname, len(par))
+	return nil
+}
+
+// ConfigExport prints the service config in the settings file format,
+// keys fixed at creation and those maintained by the service are left out
+func ConfigExport(sname string) error {
+	md, err := efsutil.GetMDPat("", "svcs", sname, "", "X-")
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	for k := range md {
+		if !isConfigKey(k) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Printf("# service %s, type %s\n", sname, md["X-Service-Type"])
+	for _, k := range keys {
+		fmt.Printf("%s: %s\n", k, efsutil.YAMLString(md[k]))
+	}
+	return nil
+}
+
 var (
+	configForce    bool
+	configListKeys bool
+	configFile     string
+	configExport   bool
+	configYes      bool
+
 	configCmd = &cobra.Command{
-		Use:   "config <service name> <key> <value>",
+		Use:   "config <service name> <key> <value> | <service name> [-f <settings>] [<key>=<value> ...]",
 		Short: "configure service",
-		Long:  "setup service parameter",
-		Args:  validate.ServiceConfig,
+		Long: `setup service parameter, validated against the schema of the service
+type unless --force is given. Several keys can be set at once from a YAML
+or JSON settings file and key=value arguments, the changes are shown and
+confirmed before they are stored. --export prints the current config in
+the settings file format, --list-keys shows the documented keys with
+their current values. Every change is recorded as a config revision.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if configListKeys || configExport || (configFile != "" && len(args) == 1) {
+				if len(args) != 1 {
+					return fmt.Errorf("Requires <service name> only")
+				}
+				return validate.Service(cmd, args)
+			}
+			if len(args) == 3 && !strings.Contains(args[1], "=") {
+				return validate.ServiceConfig(cmd, args)
+			}
+			if len(args) < 2 {
+				return fmt.Errorf("Requires <service name> <key> <value>, key=value settings or -f <settings>")
+			}
+			return validate.Service(cmd, args)
+		},
 		Run: func(cmd *cobra.Command, args []string) {
-			err := Config(args[0], args[1], args[2])
+			var err error
+			if configListKeys {
+				err = ConfigListKeys(args[0])
+			} else if configExport {
+				err = ConfigExport(args[0])
+			} else if configFile == "" && len(args) == 3 && !strings.Contains(args[1], "=") {
+				err = Config(args[0], args[1], args[2], configForce)
+			} else {
+				settings := make(map[string]string)
+				if configFile != "" {
+					settings, err = ReadConfigFile(configFile)
+				}
+				if err == nil {
+					var kv map[string]string
+					kv, err = ParseConfigArgs(args[1:])
+					for k, v := range kv {
+						settings[k] = v
+					}
+				}
+				if err == nil {
+					err = ConfigBatch(args[0], settings, configForce, configYes,
+						fmt.Sprintf("config %d key(s)", len(settings)))
+				}
+			}
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
@@ -61,5 +336,10 @@ var (
 )
 
 func init() {
+	configCmd.Flags().BoolVarP(&configForce, "force", "", false, "Store the value even if it does not match the schema")
+	configCmd.Flags().BoolVarP(&configListKeys, "list-keys", "l", false, "List documented keys with current values")
+	configCmd.Flags().StringVarP(&configFile, "file", "f", "", "YAML or JSON settings file")
+	configCmd.Flags().BoolVarP(&configExport, "export", "e", false, "Print the config in the settings file format")
+	configCmd.Flags().BoolVarP(&configYes, "yes", "y", false, "Apply settings without asking for confirmation")
 	ServiceCmd.AddCommand(configCmd)
 }
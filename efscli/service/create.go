@@ -41,6 +41,11 @@ import (
 )
 
 func ServiceCreate(stype string, sname string) error {
+	// companion buckets of a service share the svcs namespace
+	if efsutil.IsServiceCompanion(sname) {
+		return fmt.Errorf("Invalid service name %s, .stat and .history suffixes are reserved", sname)
+	}
+
 	service := C.CString(sname)
 	defer C.free(unsafe.Pointer(service))
 
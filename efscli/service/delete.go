@@ -68,6 +68,11 @@ func ServiceDelete(name string) error {
 		return fmt.Errorf("service_delete err=%d", ret)
 	}
 
+	err = ConfigHistoryDelete(name)
+	if err != nil {
+		fmt.Printf("Warning: config history of %s not removed: %v\n", name, err)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,275 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package service
+
+/*
+#include "ccow.h"
+#include "errno.h"
+*/
+import "C"
+import "unsafe"
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sabbot/module/efscli/efsutil"
+)
+
+// Config history of a service is kept in the companion bucket
+// svcs/<service>.history, one rev-<n> object per revision holding the
+// ConfigRevision as JSON. The first change of a service also records the
+// config it had before as revision 1.
+const (
+	ConfigHistorySuffix = ".history"
+	configRevPrefix     = "rev-"
+)
+
+type ConfigRevision struct {
+	Rev     int               `json:"rev"`
+	Created int64             `json:"created"`
+	User    string            `json:"user"`
+	Action  string            `json:"action"`
+	Keys    map[string]string `json:"keys"`
+}
+
+func configHistoryBucket(sname string) string {
+	return sname + ConfigHistorySuffix
+}
+
+func configRevObject(rev int) string {
+	return fmt.Sprintf("%s%08d", configRevPrefix, rev)
+}
+
+// isConfigKey tells keys set by the administrator apart from the ones
+// fixed at creation and those maintained by the service
+func isConfigKey(key string) bool {
+	return key != "X-Service-Name" && key != "X-Service-Type" && !isRuntimeConfigKey(key)
+}
+
+func configHistoryCreate(sname string) error {
+	c_bucket := C.CString(configHistoryBucket(sname))
+	defer C.free(unsafe.Pointer(c_bucket))
+
+	conf, err := efsutil.GetLibccowConf()
+	if err != nil {
+		return err
+	}
+
+	c_conf := C.CString(string(conf))
+	defer C.free(unsafe.Pointer(c_conf))
+
+	cl := C.CString("")
+	defer C.free(unsafe.Pointer(cl))
+
+	var tc C.ccow_t
+
+	ret := C.ccow_admin_init(c_conf, cl, 1, &tc)
+	if ret != 0 {
+		return fmt.Errorf("ccow_admin_init err=%d", ret)
+	}
+	defer C.ccow_tenant_term(tc)
+
+	ret = C.ccow_bucket_create(tc, c_bucket, C.strlen(c_bucket)+1, nil)
+	if ret != 0 && ret != -C.EEXIST {
+		return fmt.Errorf("%s: ccow_bucket_create err=%d", efsutil.GetFUNC(), ret)
+	}
+	return nil
+}
+
+// ConfigHistoryDelete removes the config history of a service
+func ConfigHistoryDelete(sname string) error {
+	bk := configHistoryBucket(sname)
+	entries, err := efsutil.ListObjects("", "svcs", bk, "")
+	if err != nil {
+		return nil
+	}
+	for _, e := range entries {
+		err = efsutil.ObjectDelete("", "svcs", bk, e.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	c_bucket := C.CString(bk)
+	defer C.free(unsafe.Pointer(c_bucket))
+
+	conf, err := efsutil.GetLibccowConf()
+	if err != nil {
+		return err
+	}
+
+	c_conf := C.CString(string(conf))
+	defer C.free(unsafe.Pointer(c_conf))
+
+	cl := C.CString("")
+	defer C.free(unsafe.Pointer(cl))
+
+	var tc C.ccow_t
+
+	ret := C.ccow_admin_init(c_conf, cl, 1, &tc)
+	if ret != 0 {
+		return fmt.Errorf("ccow_admin_init err=%d", ret)
+	}
+	defer C.ccow_tenant_term(tc)
+
+	ret = C.ccow_bucket_delete(tc, c_bucket, C.strlen(c_bucket)+1)
+	if ret != 0 && ret != -C.ENOENT {
+		return fmt.Errorf("%s: ccow_bucket_delete err=%d", efsutil.GetFUNC(), ret)
+	}
+	return nil
+}
+
+// ConfigRevisions returns revision numbers of a service, oldest first. The
+// history bucket is missing until the first change and lists as empty.
+func ConfigRevisions(sname string) ([]int, error) {
+	entries, err := efsutil.ListObjects("", "svcs", configHistoryBucket(sname), configRevPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []int
+	for _, e := range entries {
+		rev, err := strconv.Atoi(strings.TrimPrefix(e.Name, configRevPrefix))
+		if err == nil {
+			res = append(res, rev)
+		}
+	}
+	sort.Ints(res)
+	return res, nil
+}
+
+func LoadConfigRevision(sname string, rev int) (*ConfigRevision, error) {
+	data, err := efsutil.ObjectGetData("", "svcs", configHistoryBucket(sname), configRevObject(rev))
+	if err != nil {
+		return nil, fmt.Errorf("Service %s has no config revision %d", sname, rev)
+	}
+
+	r := new(ConfigRevision)
+	err = json.Unmarshal(data, r)
+	if err != nil {
+		return nil, fmt.Errorf("Config revision %d decoding error: %v", rev, err)
+	}
+	return r, nil
+}
+
+func saveConfigRevision(sname string, r *ConfigRevision) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return efsutil.ObjectPutData("", "svcs", configHistoryBucket(sname), configRevObject(r.Rev), data)
+}
+
+func configUser() string {
+	u, err := user.Current()
+	if err != nil {
+		return "-"
+	}
+	return u.Username
+}
+
+// recordConfig stores the current X- keys of the service as a new
+// revision, before is the key set preceding the change
+func recordConfig(sname string, before map[string]string, action string) error {
+	err := configHistoryCreate(sname)
+	if err != nil {
+		return err
+	}
+
+	revs, err := ConfigRevisions(sname)
+	if err != nil {
+		return err
+	}
+
+	next := 1
+	if len(revs) > 0 {
+		next = revs[len(revs)-1] + 1
+	} else {
+		r := &ConfigRevision{Rev: next, Created: time.Now().Unix(), User: "-",
+			Action: "initial", Keys: before}
+		err = saveConfigRevision(sname, r)
+		if err != nil {
+			return err
+		}
+		next++
+	}
+
+	md, err := efsutil.GetMDPat("", "svcs", sname, "", "X-")
+	if err != nil {
+		return err
+	}
+
+	r := &ConfigRevision{Rev: next, Created: time.Now().Unix(), User: configUser(),
+		Action: action, Keys: md}
+	return saveConfigRevision(sname, r)
+}
+
+// RecordConfig is recordConfig that only warns on failure, as the change
+// itself has already been stored
+func RecordConfig(sname string, before map[string]string, action string) {
+	err := recordConfig(sname, before, action)
+	if err != nil {
+		fmt.Printf("Warning: config revision of %s not recorded: %v\n", sname, err)
+	}
+}
+
+// configChanges counts keys which differ between two revisions
+func configChanges(before map[string]string, after map[string]string) int {
+	n := 0
+	for k, v := range after {
+		if b, ok := before[k]; !ok || b != v {
+			n++
+		}
+	}
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			n++
+		}
+	}
+	return n
+}
+
+// configRevisionKeys returns the key set of a revision, "current" stands
+// for the live config of the service
+func configRevisionKeys(sname string, rev string) (map[string]string, error) {
+	if rev == "current" {
+		return efsutil.GetMDPat("", "svcs", sname, "", "X-")
+	}
+
+	n, err := strconv.Atoi(rev)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid revision %s, expecting a number or current", rev)
+	}
+	r, err := LoadConfigRevision(sname, n)
+	if err != nil {
+		return nil, err
+	}
+	return r.Keys, nil
+}
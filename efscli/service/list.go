@@ -90,7 +90,8 @@ func ServiceList(pat string, count int) error {
 
 		if pat == "" || len(pat) == 0 {
 			found = 1
-			if !efsutil.IsSystemName(C.GoString(kv.key)) {
+			if !efsutil.IsSystemName(C.GoString(kv.key)) &&
+				!efsutil.IsServiceCompanion(C.GoString(kv.key)) {
 				fmt.Println(C.GoString(kv.key))
 			}
 			continue
@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package service
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+func LunList(sname string) error {
+	luns, err := GetLuns(sname)
+	if err != nil {
+		return err
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetBorder(false)
+	table.SetHeader([]string{"LUN", "Object", "Size", "Block size", "Chunk size"})
+	for i := range luns {
+		l := &luns[i]
+		err = lunAttributes(l)
+		if err != nil {
+			table.Append([]string{strconv.Itoa(l.ID), l.Path, "-", "-", "-"})
+			continue
+		}
+		table.Append([]string{strconv.Itoa(l.ID), l.Path, FormatBytes(int64(l.Volsize)),
+			FormatBytes(int64(l.Blocksize)), FormatBytes(int64(l.Chunksize))})
+	}
+	table.Render()
+	return nil
+}
+
+var (
+	lunListCmd = &cobra.Command{
+		Use:   "list <service name>",
+		Short: "list LUNs of an iSCSI service",
+		Long:  "list LUNs of an iSCSI service with the backing objects and volume sizes",
+		Args:  lunArgs(1, "<service name>"),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := LunList(args[0])
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	lunCmd.AddCommand(lunListCmd)
+}
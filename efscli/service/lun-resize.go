@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package service
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/im-kulikov/sizefmt"
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/spf13/cobra"
+)
+
+// LunResize grows the volume of a LUN. Shrinking would cut off data the
+// initiators may have written, thus it is refused.
+func LunResize(sname string, id int, size string, yes bool) error {
+	l, err := GetLun(sname, id)
+	if err != nil {
+		return err
+	}
+
+	bytes, err := sizefmt.ToBytes(size)
+	if err != nil {
+		return err
+	}
+	volsize := uint64(bytes)
+
+	if volsize <= l.Volsize {
+		return fmt.Errorf("LUN %d can only grow, new size %s is not above %s",
+			id, FormatBytes(int64(volsize)), FormatBytes(int64(l.Volsize)))
+	}
+	if l.Blocksize > 0 && volsize%uint64(l.Blocksize) != 0 {
+		return fmt.Errorf("New size %d is not a multiple of the block size %d", volsize, l.Blocksize)
+	}
+
+	var inUse []string
+	status, _ := efsutil.GetMDKey("", "svcs", sname, "", "X-Status")
+	if status == "enabled" {
+		inUse = append(inUse, sname)
+	}
+	inUse = append(inUse, lunUsers(sname, l)...)
+	if len(inUse) > 0 {
+		fmt.Printf("Warning: LUN %d is in use by %v, initiators have to rescan to see the new size\n", id, inUse)
+		if !yes && !efsutil.AskForConfirmation(fmt.Sprintf("Resize LUN %d?", id)) {
+			return nil
+		}
+	}
+
+	err = lunSetVolsize(l.Path, volsize)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("LUN %d of %s resized from %s to %s\n", id, sname,
+		FormatBytes(int64(l.Volsize)), FormatBytes(int64(volsize)))
+	return nil
+}
+
+var (
+	lunResizeYes bool
+
+	lunResizeCmd = &cobra.Command{
+		Use:   "resize <service name> <lun> <size>",
+		Short: "grow a LUN of an iSCSI service",
+		Long:  "grow the volume size of a LUN, the new size has to be a multiple of the block size",
+		Args:  lunArgs(3, "<service name> <lun> <size>"),
+		Run: func(cmd *cobra.Command, args []string) {
+			id, _ := strconv.Atoi(args[1])
+			err := LunResize(args[0], id, args[2], lunResizeYes)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	lunResizeCmd.Flags().BoolVarP(&lunResizeYes, "yes", "y", false, "Resize a LUN in use without asking for confirmation")
+	lunCmd.AddCommand(lunResizeCmd)
+}
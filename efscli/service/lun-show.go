@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package service
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/spf13/cobra"
+)
+
+// lunUsers returns other iSCSI service entries backed by the same object
+func lunUsers(sname string, l *Lun) []string {
+	entries, err := efsutil.GetServiceEntries("iscsi")
+	if err != nil {
+		return nil
+	}
+
+	var res []string
+	for _, e := range entries {
+		if e.Service == sname && e.Entry == l.Entry {
+			continue
+		}
+		if efsutil.ServiceObjectPath(e.Type, e.Entry) == l.Path {
+			res = append(res, e.Service+":"+e.Entry)
+		}
+	}
+	return res
+}
+
+func LunShow(sname string, id int) error {
+	l, err := GetLun(sname, id)
+	if err != nil {
+		return err
+	}
+
+	s := strings.SplitN(l.Path, "/", 4)
+	md, err := efsutil.GetMDPat(s[0], s[1], s[2], s[3], "ccow-")
+	if err != nil {
+		return err
+	}
+
+	blocks := uint64(0)
+	if l.Blocksize > 0 {
+		blocks = l.Volsize / uint64(l.Blocksize)
+	}
+	stored, _ := strconv.ParseInt(md["ccow-logical-size"], 10, 64)
+
+	users := lunUsers(sname, l)
+	if len(users) == 0 {
+		users = []string{"-"}
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	table.SetHeader([]string{"Parameter", "Value"})
+	table.Append([]string{"LUN", strconv.Itoa(l.ID)})
+	table.Append([]string{"Service", sname})
+	table.Append([]string{"Object", l.Path})
+	table.Append([]string{"Volume size", fmt.Sprintf("%s (%d)", FormatBytes(int64(l.Volsize)), l.Volsize)})
+	table.Append([]string{"Block size", strconv.FormatUint(uint64(l.Blocksize), 10)})
+	table.Append([]string{"Blocks", strconv.FormatUint(blocks, 10)})
+	table.Append([]string{"Chunk size", strconv.FormatUint(uint64(l.Chunksize), 10)})
+	table.Append([]string{"Logical size", FormatBytes(stored)})
+	table.Append([]string{"Generation", md["ccow-tx-generation-id"]})
+	table.Append([]string{"Also served by", strings.Join(users, ", ")})
+	table.Render()
+	return nil
+}
+
+var (
+	lunShowCmd = &cobra.Command{
+		Use:   "show <service name> <lun>",
+		Short: "show a LUN of an iSCSI service",
+		Long:  "show the backing object and volume attributes of a LUN",
+		Args:  lunArgs(2, "<service name> <lun>"),
+		Run: func(cmd *cobra.Command, args []string) {
+			id, _ := strconv.Atoi(args[1])
+			err := LunShow(args[0], id)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	lunCmd.AddCommand(lunShowCmd)
+}
@@ -0,0 +1,268 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package service
+
+/*
+#include "ccow.h"
+*/
+import "C"
+import "unsafe"
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/sabbot/module/efscli/validate"
+	"github.com/spf13/cobra"
+)
+
+const (
+	lunVolsizeKey   = "X-volsize"
+	lunBlocksizeKey = "X-blocksize"
+	lunChunksizeKey = "ccow-chunkmap-chunk-size"
+)
+
+// Lun is an iSCSI service entry id@<cluster>/<tenant>/<bucket>/<object>
+// with the volume attributes of the backing object
+type Lun struct {
+	ID        int
+	Path      string
+	Entry     string
+	Volsize   uint64
+	Blocksize uint32
+	Chunksize uint32
+}
+
+func parseLunEntry(entry string) (int, string, bool) {
+	p := strings.SplitN(entry, "@", 2)
+	if len(p) != 2 {
+		return 0, "", false
+	}
+	id, err := strconv.Atoi(p[0])
+	if err != nil {
+		return 0, "", false
+	}
+	return id, p[1], true
+}
+
+// nextLunId returns the lowest LUN id not used by the entries, so that
+// ids freed by unserve are reused
+func nextLunId(entries []string) int {
+	used := make(map[int]bool)
+	for _, e := range entries {
+		if id, _, ok := parseLunEntry(e); ok {
+			used[id] = true
+		}
+	}
+	id := 1
+	for used[id] {
+		id++
+	}
+	return id
+}
+
+func lunAttributes(l *Lun) error {
+	s := strings.SplitN(l.Path, "/", 4)
+	if len(s) != 4 {
+		return fmt.Errorf("LUN %d: wrong object path %s", l.ID, l.Path)
+	}
+	md, err := efsutil.GetMDPat(s[0], s[1], s[2], s[3], "")
+	if err != nil {
+		return fmt.Errorf("LUN %d object %s: %v", l.ID, l.Path, err)
+	}
+
+	l.Blocksize = 4096
+	if v, err := strconv.ParseUint(md[lunBlocksizeKey], 10, 32); err == nil {
+		l.Blocksize = uint32(v)
+	}
+	if v, err := strconv.ParseUint(md[lunChunksizeKey], 10, 32); err == nil {
+		l.Chunksize = uint32(v)
+	}
+	l.Volsize, _ = strconv.ParseUint(md[lunVolsizeKey], 10, 64)
+	return nil
+}
+
+// GetLuns lists LUNs of an iSCSI service ordered by id
+func GetLuns(sname string) ([]Lun, error) {
+	stype, err := efsutil.GetMDKey("", "svcs", sname, "", "X-Service-Type")
+	if err != nil {
+		return nil, fmt.Errorf("Service %s: %v", sname, err)
+	}
+	if stype != "iscsi" {
+		return nil, fmt.Errorf("Service %s is of type %s, not iscsi", sname, stype)
+	}
+
+	entries, err := efsutil.ListKeys("", "svcs", sname, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Lun
+	for _, e := range entries {
+		id, opath, ok := parseLunEntry(e)
+		if !ok {
+			continue
+		}
+		res = append(res, Lun{ID: id, Path: opath, Entry: e})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res, nil
+}
+
+// GetLun returns a LUN of an iSCSI service with its volume attributes
+func GetLun(sname string, id int) (*Lun, error) {
+	luns, err := GetLuns(sname)
+	if err != nil {
+		return nil, err
+	}
+	for i := range luns {
+		if luns[i].ID == id {
+			err = lunAttributes(&luns[i])
+			if err != nil {
+				return nil, err
+			}
+			return &luns[i], nil
+		}
+	}
+	return nil, fmt.Errorf("Service %s has no LUN %d", sname, id)
+}
+
+// lunSetVolsize stores the volume size of the LUN object, typed as
+// ServiceServeISCSI does
+func lunSetVolsize(opath string, volsize uint64) error {
+	s := strings.SplitN(opath, "/", 4)
+
+	conf, err := efsutil.GetLibccowConf()
+	if err != nil {
+		return err
+	}
+
+	c_conf := C.CString(string(conf))
+	defer C.free(unsafe.Pointer(c_conf))
+
+	clempty := C.CString("")
+	defer C.free(unsafe.Pointer(clempty))
+
+	var tc C.ccow_t
+
+	ret := C.ccow_admin_init(c_conf, clempty, 1, &tc)
+	if ret != 0 {
+		return fmt.Errorf("ccow_admin_init err=%d", ret)
+	}
+	defer C.ccow_tenant_term(tc)
+
+	c_cl := C.CString(s[0])
+	defer C.free(unsafe.Pointer(c_cl))
+
+	c_tn := C.CString(s[1])
+	defer C.free(unsafe.Pointer(c_tn))
+
+	c_bk := C.CString(s[2])
+	defer C.free(unsafe.Pointer(c_bk))
+
+	c_obj := C.CString(s[3])
+	defer C.free(unsafe.Pointer(c_obj))
+
+	ret = C.ccow_range_lock(tc, c_bk, C.strlen(c_bk)+1, c_obj,
+		C.strlen(c_obj)+1, 0, 1, C.CCOW_LOCK_EXCL)
+	if ret != 0 {
+		return fmt.Errorf("%s: ccow_range_lock err=%d", efsutil.GetFUNC(), ret)
+	}
+	defer C.ccow_range_lock(tc, c_bk, C.strlen(c_bk)+1, c_obj,
+		C.strlen(c_obj)+1, 0, 1, C.CCOW_LOCK_UNLOCK)
+
+	var comp C.ccow_completion_t
+	ret = C.ccow_create_completion(tc, nil, nil, 2, &comp)
+	if ret != 0 {
+		return fmt.Errorf("%s: ccow_create_completion err=%d", efsutil.GetFUNC(), ret)
+	}
+
+	var iter C.ccow_lookup_t
+	ret = C.ccow_admin_pseudo_get(c_cl, C.strlen(c_cl)+1, c_tn, C.strlen(c_tn)+1,
+		c_bk, C.strlen(c_bk)+1, c_obj, C.strlen(c_obj)+1, nil, 0, 0, C.CCOW_GET,
+		comp, &iter)
+	if ret != 0 {
+		C.ccow_release(comp)
+		return fmt.Errorf("%s: ccow_admin_pseudo_get err=%d", efsutil.GetFUNC(), ret)
+	}
+	defer C.ccow_lookup_release(iter)
+
+	ret = C.ccow_wait(comp, 0)
+	if ret != 0 {
+		return fmt.Errorf("%s: ccow_wait err=%d", efsutil.GetFUNC(), ret)
+	}
+
+	c_key := C.CString(lunVolsizeKey)
+	defer C.free(unsafe.Pointer(c_key))
+
+	ret = C.ccow_attr_modify_custom(comp, C.CCOW_KVTYPE_UINT64, c_key, C.int(C.strlen(c_key)+1),
+		unsafe.Pointer(&volsize), 8, iter)
+	if ret != 0 {
+		return fmt.Errorf("%s: ccow_attr_modify_custom %s err=%d", efsutil.GetFUNC(), lunVolsizeKey, ret)
+	}
+
+	ret = C.ccow_admin_pseudo_put(c_cl, C.strlen(c_cl)+1, c_tn, C.strlen(c_tn)+1,
+		c_bk, C.strlen(c_bk)+1, c_obj, C.strlen(c_obj)+1, nil,
+		0, 0, C.CCOW_PUT, nil, comp)
+	if ret != 0 {
+		C.ccow_release(comp)
+		return fmt.Errorf("%s: ccow_admin_pseudo_put err=%d", efsutil.GetFUNC(), ret)
+	}
+
+	ret = C.ccow_wait(comp, 1)
+	if ret != 0 {
+		return fmt.Errorf("%s: ccow_wait err=%d", efsutil.GetFUNC(), ret)
+	}
+	return nil
+}
+
+// lunArgs validates <service name> <lun> [...] arguments
+func lunArgs(n int, usage string) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if len(args) != n {
+			return fmt.Errorf("Requires %s", usage)
+		}
+		if n > 1 {
+			if _, err := strconv.Atoi(args[1]); err != nil {
+				return fmt.Errorf("Invalid LUN id %s", args[1])
+			}
+		}
+		return validate.Service(cmd, args)
+	}
+}
+
+var (
+	lunCmd = &cobra.Command{
+		Use:   "lun",
+		Short: "iSCSI LUN operations",
+		Long:  "list, show and resize LUNs of iSCSI services",
+	}
+)
+
+func init() {
+	ServiceCmd.AddCommand(lunCmd)
+}
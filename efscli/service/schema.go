@@ -0,0 +1,254 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConfigKey documents a service configuration key. Min and Max bound int
+// values, Values lists the allowed ones of enum keys. Unset keys take "-"
+// to mean not configured.
+type ConfigKey struct {
+	Key      string
+	Type     string
+	Values   []string
+	Min      int64
+	Max      int64
+	Default  string
+	Desc     string
+	Unset    bool
+	ReadOnly bool
+}
+
+// Check validates a value of the key
+func (k *ConfigKey) Check(value string) error {
+	if k.Unset && value == "-" {
+		return nil
+	}
+
+	switch k.Type {
+	case "bool":
+		if value != "true" && value != "false" {
+			return fmt.Errorf("%s expects true or false, got '%s'", k.Key, value)
+		}
+	case "int", "port":
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s expects a number, got '%s'", k.Key, value)
+		}
+		if v < k.Min || v > k.Max {
+			return fmt.Errorf("%s expects a value in range %d..%d, got %d", k.Key, k.Min, k.Max, v)
+		}
+	case "enum":
+		for _, a := range k.Values {
+			if a == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s expects one of %s, got '%s'", k.Key, strings.Join(k.Values, ", "), value)
+	case "json":
+		if !json.Valid([]byte(value)) {
+			return fmt.Errorf("%s expects a JSON document, got '%s'", k.Key, value)
+		}
+	}
+	return nil
+}
+
+// Allowed describes the accepted values
+func (k *ConfigKey) Allowed() string {
+	var res string
+	switch k.Type {
+	case "bool":
+		res = "true|false"
+	case "int", "port":
+		res = fmt.Sprintf("%d..%d", k.Min, k.Max)
+	case "enum":
+		res = strings.Join(k.Values, "|")
+	default:
+		res = k.Type
+	}
+	if k.Unset {
+		res += "|-"
+	}
+	return res
+}
+
+func portKey(key string, def string, desc string) ConfigKey {
+	return ConfigKey{Key: key, Type: "port", Min: 1, Max: 65535, Default: def, Desc: desc}
+}
+
+func boolKey(key string, def string, desc string) ConfigKey {
+	return ConfigKey{Key: key, Type: "bool", Default: def, Desc: desc}
+}
+
+func stringKey(key string, def string, desc string) ConfigKey {
+	return ConfigKey{Key: key, Type: "string", Default: def, Desc: desc, Unset: def == "-"}
+}
+
+var (
+	commonConfig = []ConfigKey{
+		{Key: "X-Service-Name", Type: "string", Desc: "Service name", ReadOnly: true},
+		{Key: "X-Service-Type", Type: "string", Desc: "Service type", ReadOnly: true},
+		stringKey("X-Description", "", "Free form description"),
+		stringKey("X-Servers", "-", "Comma separated ids of the servers running the service"),
+		{Key: "X-Status", Type: "enum", Values: []string{"enabled", "disabled"}, Default: "disabled",
+			Desc: "Whether the service is started"},
+	}
+
+	httpConfig = []ConfigKey{
+		stringKey("X-Auth-Type", "disabled", "Authentication type"),
+		boolKey("X-Need-MD5", "true", "Verify and return MD5 of object payloads"),
+		boolKey("X-ACL-On", "false", "Enforce access control lists"),
+		{Key: "X-List-Max-Size", Type: "int", Min: 1, Max: 100000, Default: "1000",
+			Desc: "Maximum number of entries returned by a list request"},
+		boolKey("X-List-Cache", "true", "Cache list results"),
+		boolKey("X-List-All-Buckets", "true", "List buckets of all users"),
+		stringKey("X-HTTPS-Key", "-", "Path of the TLS private key"),
+		stringKey("X-HTTPS-Cert", "-", "Path of the TLS certificate"),
+	}
+
+	objectConfig = []ConfigKey{
+		stringKey("X-Ciphers", "-", "Allowed TLS ciphers"),
+		boolKey("X-Trust-Proxy", "true", "Trust X-Forwarded-For headers of proxies"),
+		boolKey("X-Access-Log", "false", "Write an access log"),
+		{Key: "X-Number-Of-Versions", Type: "int", Min: 1, Max: 65535, Default: "1",
+			Desc: "Number of versions kept by buckets created through the service"},
+	}
+
+	s3Config = []ConfigKey{
+		stringKey("X-Region", "-", "Region reported to clients"),
+		stringKey("X-Default-Tenant", "-", "Tenant used when the request does not name one"),
+		stringKey("X-Default-Owner", "-", "Owner of buckets created without authentication"),
+	}
+
+	configSchemas = map[string][][]ConfigKey{
+		"nfs": {commonConfig, {
+			stringKey("X-Auth-Type", "disabled", "Authentication type"),
+			{Key: "X-MH-ImmDir", Type: "enum", Values: []string{"0", "1"}, Default: "1",
+				Desc: "Update directory metadata immediately"},
+		}},
+		"iscsi": {commonConfig, {
+			{Key: "X-ISCSI-Params", Type: "json", Default: "{}", Desc: "Target parameters as a JSON object"},
+			{Key: "X-ISCSI-TargetID", Type: "int", Min: 0, Max: 65535, Desc: "Target id"},
+			stringKey("X-ISCSI-TargetName", "iqn.2018-11.edgefs.io:", "Target IQN prefix"),
+			stringKey("X-ISCSI-AllowedInitiatorAddresses", "ALL", "Comma separated initiator addresses allowed, ALL for any"),
+		}},
+		"s3": {commonConfig, httpConfig, objectConfig, s3Config, {
+			portKey("X-HTTP-Port", "9982", "HTTP port"),
+			portKey("X-HTTPS-Port", "9443", "HTTPS port"),
+		}},
+		"s3s": {commonConfig, httpConfig, objectConfig, s3Config, {
+			stringKey("X-Domain", "example.com", "Domain of DNS style bucket names"),
+			portKey("X-HTTP-Port", "9983", "HTTP port"),
+			portKey("X-HTTPS-Port", "9444", "HTTPS port"),
+		}},
+		"s3x": {commonConfig, httpConfig, {
+			portKey("X-HTTP-Port", "4000", "HTTP port"),
+			portKey("X-HTTPS-Port", "4443", "HTTPS port"),
+		}},
+		"swift": {commonConfig, httpConfig, objectConfig, {
+			{Key: "X-Auth-TTL", Type: "int", Min: 1, Max: 31536000, Default: "600",
+				Desc: "Lifetime of authentication tokens in seconds"},
+			stringKey("X-Swift-Versioning", "disabled", "Object versioning mode"),
+			portKey("X-HTTP-Port", "9981", "HTTP port"),
+			portKey("X-HTTPS-Port", "9442", "HTTPS port"),
+		}},
+		"isgw": {commonConfig, {
+			stringKey("X-Auth-Type", "disabled", "Authentication type"),
+			stringKey("X-ISGW-Local", "-", "Local endpoint address:port"),
+			stringKey("X-ISGW-DFLocal", "-", "Local dynamic fetch endpoint address:port"),
+			stringKey("X-ISGW-Remote", "-", "Remote endpoint URL"),
+			stringKey("X-Container-Network", "-", "Container network of the gateway"),
+			stringKey("X-ISGW-Basic-Auth", "-", "Basic authentication user:password"),
+			stringKey("X-ISGW-Direction", "-", "Replication direction"),
+			stringKey("X-ISGW-Replication", "-", "Replication mode"),
+			stringKey("X-ISGW-MDOnly", "-", "Replicate metadata only"),
+			{Key: "X-ISGW-Number-Of-Connections", Type: "int", Min: 1, Max: 64, Default: "2",
+				Desc: "Number of connections to the remote endpoint"},
+			stringKey("X-ISGW-Encrypted-Tunnel", "-", "Encrypted tunnel settings"),
+		}},
+	}
+
+	// runtimeConfigPrefixes are keys maintained by running services
+	runtimeConfigPrefixes = []string{"X-ContainerIPv6-", "X-Container-Hostname-", "X-ContainerId-"}
+)
+
+// ConfigSchema returns the documented keys of a service type sorted by
+// name, later definitions of a key override earlier ones
+func ConfigSchema(stype string) ([]ConfigKey, error) {
+	groups, ok := configSchemas[stype]
+	if !ok {
+		return nil, fmt.Errorf("No configuration schema for service type %s", stype)
+	}
+
+	keys := make(map[string]ConfigKey)
+	for _, g := range groups {
+		for _, k := range g {
+			keys[k.Key] = k
+		}
+	}
+
+	var res []ConfigKey
+	for _, k := range keys {
+		res = append(res, k)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Key < res[j].Key })
+	return res, nil
+}
+
+// ValidateConfig checks a key and its value against the schema of the
+// service type
+func ValidateConfig(stype string, key string, value string) error {
+	schema, err := ConfigSchema(stype)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range runtimeConfigPrefixes {
+		if strings.HasPrefix(key, p) {
+			return fmt.Errorf("%s is maintained by the running service", key)
+		}
+	}
+
+	for _, k := range schema {
+		if k.Key == key {
+			if k.ReadOnly {
+				return fmt.Errorf("%s is set on service creation and cannot be changed", key)
+			}
+			return k.Check(value)
+		}
+	}
+
+	for _, k := range schema {
+		if strings.EqualFold(k.Key, key) {
+			return fmt.Errorf("Unknown key %s for service type %s, did you mean %s?", key, stype, k.Key)
+		}
+	}
+	return fmt.Errorf("Unknown key %s for service type %s", key, stype)
+}
@@ -119,9 +119,7 @@ func ServiceServeISCSI(sname string, opath string, opts string) error {
 		}
 	}
 
-	var maxLunId int = 0
-
-	keys, err := efsutil.GetKeys("", "svcs", sname, "", 1000)
+	keys, err := efsutil.ListKeys("", "svcs", sname, "")
 	if err != nil {
 		return err
 	}
@@ -129,13 +127,10 @@ func ServiceServeISCSI(sname string, opath string, opts string) error {
 	suffix := fmt.Sprintf("@%s", opath)
 	for _, key := range keys {
 		p := strings.Split(key, "@")
-		id, e := strconv.Atoi(p[0])
+		_, e := strconv.Atoi(p[0])
 		if e != nil || len(p) < 2 {
 			continue
 		}
-		if id > maxLunId {
-			maxLunId = id
-		}
 
 		if strings.HasSuffix(p[1], suffix) {
 			return fmt.Errorf("LUN already exists: %s", suffix)
@@ -176,7 +171,7 @@ func ServiceServeISCSI(sname string, opath string, opts string) error {
 	}
 	defer C.ccow_tenant_term(tc)
 
-	newLun := fmt.Sprintf("%d@%s", (maxLunId + 1), opath)
+	newLun := fmt.Sprintf("%d@%s", nextLunId(keys), opath)
 	fmt.Printf("Serving new LUN %s\n", newLun)
 
 	c_lun := C.CString(newLun)
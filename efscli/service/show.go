@@ -114,10 +114,12 @@ func Show(name string, stat bool) error {
 		sname := name + ".stat"
 		kv, err := efsutil.GetKeyValues("", "svcs", sname, "", "", 4096, 1000)
 		if err == nil {
+			var all []Stat
 			for i := 0; i < len(kv); i++ {
 				stat := new(Stat)
 				e := json.Unmarshal([]byte(kv[i].Value), stat)
 				if e == nil {
+					all = append(all, *stat)
 					fmt.Printf("\nStats for %s:\n\n", kv[i].Key)
 					table := tablewriter.NewWriter(os.Stdout)
 					table.SetBorder(false)
@@ -151,21 +153,32 @@ func Show(name string, stat bool) error {
 				}
 
 			}
+			if len(all) > 1 {
+				printStatSummary(all)
+			}
 		}
 	}
 	return ret
 }
 
 var (
-	stat bool
+	stat      bool
+	statWatch time.Duration
 
 	showCmd = &cobra.Command{
 		Use:   "show <service name>",
 		Short: "show service",
-		Long:  "show parameters of existing service",
-		Args:  validate.Service,
+		Long: `show parameters of existing service. With --watch the stats are
+refreshed in place with per-second rates computed from successive samples,
+growing error counters and rising delays are highlighted.`,
+		Args: validate.Service,
 		Run: func(cmd *cobra.Command, args []string) {
-			err := Show(args[0], stat)
+			var err error
+			if statWatch > 0 {
+				err = ShowStatWatch(args[0], statWatch)
+			} else {
+				err = Show(args[0], stat)
+			}
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
@@ -176,5 +189,6 @@ var (
 
 func init() {
 	showCmd.Flags().BoolVarP(&stat, "stat", "s", false, "Show service stats")
+	showCmd.Flags().DurationVarP(&statWatch, "watch", "w", 0, "Refresh stats with rates every interval, e.g. 2s")
 	ServiceCmd.AddCommand(showCmd)
 }
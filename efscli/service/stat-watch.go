@@ -0,0 +1,254 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/sabbot/module/efscli/efsutil"
+)
+
+const (
+	colorRed    = "\x1b[31m"
+	colorYellow = "\x1b[33m"
+	colorReset  = "\x1b[0m"
+	clearScreen = "\x1b[H\x1b[2J"
+)
+
+// statRate holds per-second rates of the cumulative Stat counters
+type statRate struct {
+	valid    bool
+	requests float64
+	sent     float64
+	received float64
+	chunks   float64
+}
+
+// sumStats aggregates stat entries of a service, e.g. every ISGW link:
+// counters and throughputs add up, delay and latency are the worst ones
+func sumStats(stats []Stat) Stat {
+	var t Stat
+	for _, s := range stats {
+		if s.Timestamp > t.Timestamp {
+			t.Timestamp = s.Timestamp
+		}
+		if s.Delay > t.Delay {
+			t.Delay = s.Delay
+		}
+		if s.Latency > t.Latency {
+			t.Latency = s.Latency
+		}
+		t.Requests += s.Requests
+		t.Version_manifests += s.Version_manifests
+		t.Chunk_manifests += s.Chunk_manifests
+		t.Data_chunks += s.Data_chunks
+		t.Snapviews += s.Snapviews
+		t.Bytes += s.Bytes
+		t.Received_data_chunks += s.Received_data_chunks
+		t.Received_bytes += s.Received_bytes
+		t.Send_throughput += s.Send_throughput
+		t.Receive_throughput += s.Receive_throughput
+		t.Network_errors += s.Network_errors
+		t.Local_io_errors += s.Local_io_errors
+		t.Remote_io_errors += s.Remote_io_errors
+	}
+	return t
+}
+
+func printStatSummary(stats []Stat) {
+	t := sumStats(stats)
+
+	fmt.Printf("Summary of %d stat entries:\n\n", len(stats))
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetBorder(false)
+	table.SetHeader([]string{"Parameter", "Value"})
+	table.Append([]string{"Max processing delay", FormatDuration(t.Delay)})
+	table.Append([]string{"Max latency", FormatDuration(t.Latency)})
+	table.Append([]string{"Requests", fmt.Sprintf("%-16d", t.Requests)})
+	table.Append([]string{"Data chunks sent", fmt.Sprintf("%-16d", t.Data_chunks)})
+	table.Append([]string{"Data chunks received", fmt.Sprintf("%-16d", t.Received_data_chunks)})
+	table.Append([]string{"Bytes sent", fmt.Sprintf("%-16s", FormatBytes(t.Bytes))})
+	table.Append([]string{"Bytes received", fmt.Sprintf("%-16s", FormatBytes(t.Received_bytes))})
+	table.Append([]string{"Send throughput per sec", fmt.Sprintf("%-16s", FormatBytes(t.Send_throughput))})
+	table.Append([]string{"Receive throughput per sec", fmt.Sprintf("%-16s", FormatBytes(t.Receive_throughput))})
+	table.Append([]string{"Network errors", fmt.Sprintf("%-16d", t.Network_errors)})
+	table.Append([]string{"Local io errors", fmt.Sprintf("%-16d", t.Local_io_errors)})
+	table.Append([]string{"Remote io errors", fmt.Sprintf("%-16d", t.Remote_io_errors)})
+	table.Render()
+	fmt.Println()
+}
+
+// statRates computes rates between two samples of an entry, using the
+// timestamps the service put in them. Counters going back mean the
+// service restarted, no rate is known then.
+func statRates(prev Stat, cur Stat) statRate {
+	dt := float64(cur.Timestamp-prev.Timestamp) / 1000
+	if dt <= 0 || cur.Requests < prev.Requests || cur.Bytes < prev.Bytes ||
+		cur.Received_bytes < prev.Received_bytes {
+		return statRate{}
+	}
+	return statRate{
+		valid:    true,
+		requests: float64(cur.Requests-prev.Requests) / dt,
+		sent:     float64(cur.Bytes-prev.Bytes) / dt,
+		received: float64(cur.Received_bytes-prev.Received_bytes) / dt,
+		chunks:   float64(cur.Data_chunks+cur.Received_data_chunks-prev.Data_chunks-prev.Received_data_chunks) / dt,
+	}
+}
+
+func highlight(s string, color string, on bool) string {
+	if !on {
+		return s
+	}
+	return color + s + colorReset
+}
+
+func formatRate(r statRate, v float64, bytes bool) string {
+	if !r.valid {
+		return "-"
+	}
+	if bytes {
+		return FormatBytes(int64(v)) + "/s"
+	}
+	return fmt.Sprintf("%.1f", v)
+}
+
+// statRow formats an entry, prev is the previous sample if there is one
+func statRow(name string, cur Stat, prev *Stat, r statRate) []string {
+	grew := func(c int64, p int64) bool { return prev != nil && c > p }
+	var p Stat
+	if prev != nil {
+		p = *prev
+	}
+
+	return []string{
+		name,
+		cur.Status,
+		formatRate(r, r.requests, false),
+		formatRate(r, r.sent, true),
+		formatRate(r, r.received, true),
+		formatRate(r, r.chunks, false),
+		highlight(FormatDuration(cur.Delay), colorYellow, grew(cur.Delay, p.Delay)),
+		highlight(FormatDuration(cur.Latency), colorYellow, grew(cur.Latency, p.Latency)),
+		highlight(fmt.Sprintf("%d", cur.Network_errors), colorRed, grew(cur.Network_errors, p.Network_errors)),
+		highlight(fmt.Sprintf("%d", cur.Local_io_errors), colorRed, grew(cur.Local_io_errors, p.Local_io_errors)),
+		highlight(fmt.Sprintf("%d", cur.Remote_io_errors), colorRed, grew(cur.Remote_io_errors, p.Remote_io_errors)),
+	}
+}
+
+func loadStats(name string) (map[string]Stat, error) {
+	kv, err := efsutil.GetKeyValues("", "svcs", name+".stat", "", "", 4096, 1000)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]Stat)
+	for _, e := range kv {
+		var s Stat
+		if json.Unmarshal([]byte(e.Value), &s) == nil {
+			res[e.Key] = s
+		}
+	}
+	return res, nil
+}
+
+// ShowStatWatch refreshes the stats of a service every interval until
+// interrupted. Rates of an entry are kept until the service publishes a
+// newer sample of it.
+func ShowStatWatch(name string, interval time.Duration) error {
+	if !efsutil.CheckService(name) {
+		return fmt.Errorf("Service %s not found", name)
+	}
+
+	prev := make(map[string]Stat)
+	rates := make(map[string]statRate)
+	var prevTotal *Stat
+
+	for {
+		stats, err := loadStats(name)
+		if err != nil {
+			return err
+		}
+
+		var keys []string
+		for k := range stats {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		fmt.Print(clearScreen)
+		fmt.Printf("Stats of %s every %v, %s\n\n", name, interval, time.Now().Format(time.RFC3339))
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetBorder(false)
+		table.SetAutoWrapText(false)
+		table.SetHeader([]string{"Entry", "Status", "Req/s", "Sent/s", "Recv/s", "Chunks/s",
+			"Delay", "Latency", "Net errors", "Local io errors", "Remote io errors"})
+
+		var all []Stat
+		var total statRate
+		for _, k := range keys {
+			cur := stats[k]
+			all = append(all, cur)
+
+			var p *Stat
+			if ps, ok := prev[k]; ok {
+				p = &ps
+				if cur.Timestamp != ps.Timestamp {
+					rates[k] = statRates(ps, cur)
+				}
+			}
+
+			r := rates[k]
+			if r.valid {
+				total.valid = true
+				total.requests += r.requests
+				total.sent += r.sent
+				total.received += r.received
+				total.chunks += r.chunks
+			}
+			table.Append(statRow(k, cur, p, r))
+		}
+
+		t := sumStats(all)
+		if len(keys) > 1 {
+			t.Status = fmt.Sprintf("%d entries", len(keys))
+			table.Append(statRow("TOTAL", t, prevTotal, total))
+		}
+		table.Render()
+
+		if len(keys) == 0 {
+			fmt.Printf("No stats published by %s\n", name)
+		}
+
+		prev = stats
+		prevTotal = &t
+		time.Sleep(interval)
+	}
+}
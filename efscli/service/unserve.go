@@ -444,6 +444,34 @@ func ServiceUnserve(sname string, bpath string) error {
 	return fmt.Errorf("Unknown service type |%s|", stype)
 }
 
+// CheckUnserve tells whether UnserveEntry knows the type of the entry, so
+// that callers can fail before they delete anything
+func CheckUnserve(e efsutil.ServiceEntry) error {
+	switch e.Type {
+	case "nfs", "iscsi", "s3", "s3x", "s3s", "swift", "isgw":
+		return nil
+	}
+	return fmt.Errorf("Service %s entry %s has unknown type |%s|", e.Service, e.Entry, e.Type)
+}
+
+// UnserveEntry removes a service entry as listed by GetServiceEntries
+func UnserveEntry(e efsutil.ServiceEntry) error {
+	switch e.Type {
+	case "nfs":
+		return ServiceUnserveNFS(e.Service, efsutil.ServiceObjectPath(e.Type, e.Entry))
+	case "iscsi":
+		return ServiceUnserveISCSI(e.Service, e.Entry)
+	case "s3", "s3x":
+		return ServiceUnserveS3(e.Service, e.Entry)
+	case "isgw":
+		return ServiceUnserveISGW(e.Service, e.Entry)
+	case "s3s", "swift":
+		// tenant entries without state of their own
+		return efsutil.RemoveServiceEntry(e.Service, e.Entry)
+	}
+	return fmt.Errorf("Unknown service type |%s|", e.Type)
+}
+
 var (
 	unserveCmd = &cobra.Command{
 		Use:   "unserve <service> <path>",
@@ -0,0 +1,438 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package system
+
+/*
+#include "auditd.h"
+*/
+import "C"
+import "unsafe"
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/sabbot/module/efscli/service"
+	"github.com/spf13/cobra"
+)
+
+const (
+	metricsPrefix = "edgefs_"
+	gwPseudoVdev  = "00000000000000000000000000000000"
+)
+
+var (
+	statsServerRe  = regexp.MustCompile(`^gauges\.ccow\.clengine\.server\.(\w+)\.(\w+)\.(\w+)\|(\d+\.\d+)\|(\d+)`)
+	statsHostRe    = regexp.MustCompile(`^gauges\.ccow\.host\.(\w+)\.(\w+)\.(\w+)\|(\d+\.\d+)\|(\d+)`)
+	statsHostStrRe = regexp.MustCompile(`^gauges\.ccow\.host\.(\w+)\.(\w+)\.(\w+)\.(.*)\|(\d+\.\d+)\|(\d+)`)
+	statsVdevRe    = regexp.MustCompile(`^gauges\.ccow\.reptrans\.(\w+)\.(\w+)\.(\w+)\|(\d+\.\d+)\|(\d+)`)
+	statsVdevStrRe = regexp.MustCompile(`^gauges\.ccow\.reptrans\.(\w+)\.(\w+)\.(\w+)\.(.*)\|(\d+\.\d+)\|(\d+)`)
+	statsTimerRe   = regexp.MustCompile(`^timers\.ccow\.reptrans\.(\w+)\.(\w+)\.(\w+)\.(\w+)\|(\d+\.\d+)\|(\d+)`)
+)
+
+// statsDB is a snapshot of $NEDGE_HOME/var/run/stats.db, samples older
+// than dbStatExpiration are left out and make their VDEV faulted
+type statsDB struct {
+	vdevState  map[string]float64 // vdev id -> 0 faulted, 1 online, 2 read-only
+	vdevServer map[string]string
+	vdevGauges map[string]map[string]float64
+	vdevTimers map[string]map[string]float64 // "<timer>.<stat>"
+	vdevStrs   map[string]map[string]string
+	hostGauges map[string]map[string]float64
+	hostStrs   map[string]map[string]string
+}
+
+// seedCheckpointVdevs marks every VDEV of the flexhash checkpoint faulted,
+// so that one whose server stopped reporting shows up as 0 rather than
+// disappearing. Lines of stats.db override the state.
+func (db *statsDB) seedCheckpointVdevs() {
+	data, err := ioutil.ReadFile(os.Getenv("NEDGE_HOME") + "/var/run/flexhash-checkpoint.json")
+	if err != nil {
+		return
+	}
+
+	var cp struct {
+		Vdevlist []struct {
+			Serverid string `json:"serverid"`
+			Vdevid   string `json:"vdevid"`
+		} `json:"vdevlist"`
+	}
+	if json.Unmarshal(data, &cp) != nil {
+		return
+	}
+	for _, v := range cp.Vdevlist {
+		if v.Vdevid == "" {
+			continue
+		}
+		db.vdevServer[v.Vdevid] = v.Serverid
+		db.vdevState[v.Vdevid] = 0
+	}
+}
+
+func readStatsDB() (*statsDB, error) {
+	var lock *C.void = nil
+	l := unsafe.Pointer(lock)
+	rc := C.auditd_stats_sharedlock(&l)
+	if rc != 0 {
+		return nil, fmt.Errorf("Couldn't acquire a lock on stats.db")
+	}
+	defer C.auditd_stats_sharedunlock(l)
+
+	f, err := os.Open(os.Getenv("NEDGE_HOME") + "/var/run/stats.db")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	db := &statsDB{
+		vdevState:  make(map[string]float64),
+		vdevServer: make(map[string]string),
+		vdevGauges: make(map[string]map[string]float64),
+		vdevTimers: make(map[string]map[string]float64),
+		vdevStrs:   make(map[string]map[string]string),
+		hostGauges: make(map[string]map[string]float64),
+		hostStrs:   make(map[string]map[string]string),
+	}
+	db.seedCheckpointVdevs()
+	setNum := func(m map[string]map[string]float64, id string, key string, v float64) {
+		if _, ok := m[id]; !ok {
+			m[id] = make(map[string]float64)
+		}
+		m[id][key] = v
+	}
+	setStr := func(m map[string]map[string]string, id string, key string, v string) {
+		if _, ok := m[id]; !ok {
+			m[id] = make(map[string]string)
+		}
+		m[id][key] = v
+	}
+	fresh := func(ts string) bool {
+		t, err := strconv.Atoi(ts)
+		return err == nil && int(time.Now().Unix()) <= t+dbStatExpiration
+	}
+
+	rd := bufio.NewReader(f)
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+
+		if m := statsServerRe.FindStringSubmatch(line); m != nil {
+			v, _ := strconv.ParseFloat(m[4], 64)
+			if !fresh(m[5]) {
+				v = 0
+			}
+			db.vdevServer[m[3]] = m[1]
+			db.vdevState[m[3]] = v
+		} else if m := statsHostRe.FindStringSubmatch(line); m != nil {
+			if v, err := strconv.ParseFloat(m[4], 64); err == nil && fresh(m[5]) {
+				setNum(db.hostGauges, m[2], m[1], v)
+			}
+		} else if m := statsHostStrRe.FindStringSubmatch(line); m != nil {
+			if fresh(m[6]) {
+				setStr(db.hostStrs, m[2], m[1], m[4])
+			}
+		} else if m := statsVdevRe.FindStringSubmatch(line); m != nil {
+			if v, err := strconv.ParseFloat(m[4], 64); err == nil && fresh(m[5]) {
+				setNum(db.vdevGauges, m[3], m[1], v)
+			}
+		} else if m := statsVdevStrRe.FindStringSubmatch(line); m != nil {
+			if fresh(m[6]) {
+				setStr(db.vdevStrs, m[3], m[1], m[4])
+			}
+		} else if m := statsTimerRe.FindStringSubmatch(line); m != nil {
+			if v, err := strconv.ParseFloat(m[5], 64); err == nil && fresh(m[6]) {
+				setNum(db.vdevTimers, m[3], m[1]+"."+m[4], v)
+			}
+		}
+	}
+	return db, nil
+}
+
+type metricFamily struct {
+	help    string
+	typ     string
+	samples []string
+}
+
+// metrics renders the Prometheus text exposition format
+type metrics struct {
+	families map[string]*metricFamily
+}
+
+func newMetrics() *metrics {
+	return &metrics{families: make(map[string]*metricFamily)}
+}
+
+var metricNameRe = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+func metricLabelValue(v string) string {
+	v = strings.Replace(v, `\`, `\\`, -1)
+	v = strings.Replace(v, "\n", `\n`, -1)
+	return strings.Replace(v, `"`, `\"`, -1)
+}
+
+// add records a sample, labels are given as name, value pairs
+func (m *metrics) add(name string, typ string, help string, value float64, labels ...string) {
+	name = metricsPrefix + metricNameRe.ReplaceAllString(name, "_")
+	f, ok := m.families[name]
+	if !ok {
+		f = &metricFamily{help: help, typ: typ}
+		m.families[name] = f
+	}
+
+	var ls []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		ls = append(ls, labels[i]+"=\""+metricLabelValue(labels[i+1])+"\"")
+	}
+	sample := name
+	if len(ls) > 0 {
+		sample += "{" + strings.Join(ls, ",") + "}"
+	}
+	f.samples = append(f.samples, sample+" "+strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func (m *metrics) write(w io.Writer) {
+	var names []string
+	for n := range m.families {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		f := m.families[n]
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", n, f.help, n, f.typ)
+		for _, s := range f.samples {
+			fmt.Fprintln(w, s)
+		}
+	}
+}
+
+func collectStatsDB(m *metrics, db *statsDB) {
+	var capacity, used, objects float64
+
+	for vdev, state := range db.vdevState {
+		if vdev == gwPseudoVdev {
+			continue
+		}
+		server := db.vdevServer[vdev]
+		m.add("vdev_state", "gauge", "VDEV state, 0 faulted, 1 online, 2 read-only",
+			state, "server", server, "vdev", vdev, "devname", db.vdevStrs[vdev]["devname"])
+
+		for key, v := range db.vdevGauges[vdev] {
+			switch key {
+			case "capacity":
+				m.add("vdev_capacity_bytes", "gauge", "VDEV capacity", v, "server", server, "vdev", vdev)
+			case "used":
+				m.add("vdev_used_bytes", "gauge", "VDEV used space", v, "server", server, "vdev", vdev)
+			case "num_objects":
+				m.add("vdev_objects", "gauge", "Number of versions stored on the VDEV", v, "server", server, "vdev", vdev)
+			default:
+				m.add("vdev_gauge", "gauge", "Other VDEV gauges", v, "server", server, "vdev", vdev, "name", key)
+			}
+		}
+		for key, v := range db.vdevTimers[vdev] {
+			s := strings.SplitN(key, ".", 2)
+			m.add("vdev_timer", "gauge", "VDEV timers", v, "server", server, "vdev", vdev,
+				"name", s[0], "stat", s[1])
+		}
+
+		if state != 0 {
+			capacity += db.vdevGauges[vdev]["capacity"]
+			used += db.vdevGauges[vdev]["used"]
+			objects += db.vdevGauges[vdev]["num_objects"]
+		}
+	}
+
+	m.add("capacity_bytes", "gauge", "Capacity of online VDEVs", capacity)
+	m.add("used_bytes", "gauge", "Used space of online VDEVs", used)
+	m.add("objects", "gauge", "Number of versions stored on online VDEVs", objects)
+
+	for sid, gauges := range db.hostGauges {
+		for key, v := range gauges {
+			m.add("host_"+key, "gauge", "Host gauge "+key, v, "server", sid)
+		}
+	}
+	for sid, strs := range db.hostStrs {
+		m.add("server_info", "gauge", "Server host names", 1, "server", sid,
+			"hostname", strs["hostname"], "containerid", strs["containerid"])
+	}
+}
+
+func collectTrlog(m *metrics) error {
+	marker, err := readTrlogMarker()
+	if err != nil {
+		return err
+	}
+	if marker > 0 {
+		lag := float64(time.Now().UnixNano()/1000-marker) / 1e6
+		m.add("trlog_marker_lag_seconds", "gauge", "Age of the last processed transaction log interval", lag)
+	}
+	return nil
+}
+
+func collectServices(m *metrics) error {
+	services, err := efsutil.GetServices()
+	if err != nil {
+		return err
+	}
+
+	for _, svc := range services {
+		md, err := efsutil.GetMDPat("", "svcs", svc, "", "X-")
+		if err != nil {
+			continue
+		}
+		stype := md["X-Service-Type"]
+		enabled := 0.0
+		if md["X-Status"] == "enabled" {
+			enabled = 1
+		}
+		m.add("service_enabled", "gauge", "Whether the service is enabled", enabled,
+			"service", svc, "type", stype)
+
+		kv, err := efsutil.GetKeyValues("", "svcs", svc+".stat", "", "", 4096, 1000)
+		if err != nil {
+			continue
+		}
+		for _, e := range kv {
+			var s service.Stat
+			if json.Unmarshal([]byte(e.Value), &s) != nil {
+				continue
+			}
+			l := []string{"service", svc, "type", stype, "entry", e.Key}
+			counter := func(name string, help string, v int64) {
+				m.add("service_"+name+"_total", "counter", help, float64(v), l...)
+			}
+			gauge := func(name string, help string, v float64) {
+				m.add("service_"+name, "gauge", help, v, l...)
+			}
+
+			gauge("stat_timestamp_seconds", "Time of the stat sample", float64(s.Timestamp)/1000)
+			gauge("delay_seconds", "Processing delay", float64(s.Delay)/1000)
+			gauge("latency_seconds", "Latency", float64(s.Latency)/1000)
+			gauge("send_throughput_bytes", "Send throughput per second", float64(s.Send_throughput))
+			gauge("receive_throughput_bytes", "Receive throughput per second", float64(s.Receive_throughput))
+			counter("requests", "Requests", s.Requests)
+			counter("version_manifests", "Version manifests", s.Version_manifests)
+			counter("chunk_manifests", "Chunk manifests", s.Chunk_manifests)
+			counter("data_chunks_sent", "Data chunks sent", s.Data_chunks)
+			counter("data_chunks_received", "Data chunks received", s.Received_data_chunks)
+			counter("snapviews", "Snapviews", s.Snapviews)
+			counter("bytes_sent", "Bytes sent", s.Bytes)
+			counter("bytes_received", "Bytes received", s.Received_bytes)
+			counter("network_errors", "Network errors", s.Network_errors)
+			counter("local_io_errors", "Local I/O errors", s.Local_io_errors)
+			counter("remote_io_errors", "Remote I/O errors", s.Remote_io_errors)
+		}
+	}
+	return nil
+}
+
+var exporterMutex sync.Mutex
+
+// exporterMetrics collects a scrape, a source which fails is reported by
+// edgefs_scrape_error rather than failing the whole scrape
+func exporterMetrics(w io.Writer) {
+	exporterMutex.Lock()
+	defer exporterMutex.Unlock()
+
+	start := time.Now()
+	m := newMetrics()
+
+	scrapeError := func(source string, err error) {
+		v := 0.0
+		if err != nil {
+			v = 1
+			fmt.Fprintf(os.Stderr, "exporter: %s: %v\n", source, err)
+		}
+		m.add("scrape_error", "gauge", "Whether collecting the source failed", v, "source", source)
+	}
+
+	db, err := readStatsDB()
+	if err == nil {
+		collectStatsDB(m, db)
+	}
+	scrapeError("statsdb", err)
+	scrapeError("trlog", collectTrlog(m))
+	scrapeError("services", collectServices(m))
+
+	m.add("scrape_duration_seconds", "gauge", "Time taken by the scrape", time.Since(start).Seconds())
+	m.write(w)
+}
+
+func SystemExporter(listen string) error {
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		exporterMetrics(w)
+	})
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "<html><body><a href=\"/metrics\">Metrics</a></body></html>\n")
+	})
+
+	fmt.Printf("Serving metrics on %s/metrics\n", listen)
+	return http.ListenAndServe(listen, nil)
+}
+
+var (
+	exporterListen string
+
+	ExporterCmd = &cobra.Command{
+		Use:   "exporter",
+		Short: "serve cluster and service statistics to Prometheus",
+		Long: `serve VDEV state and capacity, host gauges, transaction log marker lag
+and service stats on an HTTP /metrics endpoint in the Prometheus format`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := SystemExporter(exporterListen)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	ExporterCmd.Flags().StringVarP(&exporterListen, "listen", "l", ":9876", "Address to listen on")
+	SystemCmd.AddCommand(ExporterCmd)
+}
@@ -0,0 +1,360 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package system
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Metadata backup document, version 1
+//
+// A JSON document with every cluster, tenant and bucket along with its
+// metadata, the users of each tenant, every service with its metadata and
+// served entries and the X- keys of the svcs tenant, e.g. attribute
+// profiles. Object data is not part of it. User secrets are kept in clear
+// unless encrypted with AES-256-GCM, the key is derived from a passphrase
+// with PBKDF2-SHA256 and its parameters are recorded in Secrets.
+const (
+	metadataFormat  = "efscli-metadata"
+	metadataVersion = 1
+
+	secretsCipher     = "aes-256-gcm"
+	secretsKDF        = "pbkdf2-sha256"
+	secretsIterations = 100000
+
+	passphraseEnv = "EFSCLI_BACKUP_PASSPHRASE"
+)
+
+type MetadataSecrets struct {
+	Cipher     string `json:"cipher"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       string `json:"salt"`
+}
+
+type BackupBucket struct {
+	Name     string            `json:"name"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+type BackupTenant struct {
+	Name     string            `json:"name"`
+	Metadata map[string]string `json:"metadata"`
+	Buckets  []BackupBucket    `json:"buckets"`
+	Users    []efsutil.User    `json:"users"`
+}
+
+type BackupCluster struct {
+	Name     string            `json:"name"`
+	Metadata map[string]string `json:"metadata"`
+	Tenants  []BackupTenant    `json:"tenants"`
+}
+
+type BackupService struct {
+	Name     string            `json:"name"`
+	Metadata map[string]string `json:"metadata"`
+	Entries  []string          `json:"entries"`
+}
+
+type MetadataBackup struct {
+	Format   string            `json:"format"`
+	Version  int               `json:"version"`
+	Created  int64             `json:"created"`
+	Secrets  *MetadataSecrets  `json:"secrets,omitempty"`
+	System   map[string]string `json:"system"`
+	Clusters []BackupCluster   `json:"clusters"`
+	Services []BackupService   `json:"services"`
+}
+
+// ReadPassphrase takes the passphrase from a file, the first line of it,
+// or from the EFSCLI_BACKUP_PASSPHRASE environment variable
+func ReadPassphrase(fpath string) (string, error) {
+	if fpath != "" {
+		b, err := ioutil.ReadFile(fpath)
+		if err != nil {
+			return "", err
+		}
+		p := strings.TrimRight(strings.SplitN(string(b), "\n", 2)[0], "\r")
+		if p == "" {
+			return "", fmt.Errorf("Passphrase file %s is empty", fpath)
+		}
+		return p, nil
+	}
+	p := os.Getenv(passphraseEnv)
+	if p == "" {
+		return "", fmt.Errorf("No passphrase, use --passphrase-file or set %s", passphraseEnv)
+	}
+	return p, nil
+}
+
+func secretsAEAD(s *MetadataSecrets, passphrase string) (cipher.AEAD, error) {
+	if s.Cipher != secretsCipher || s.KDF != secretsKDF {
+		return nil, fmt.Errorf("Unsupported secrets encryption %s/%s", s.Cipher, s.KDF)
+	}
+	salt, err := base64.StdEncoding.DecodeString(s.Salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(passphrase), salt, s.Iterations, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func newSecrets() (*MetadataSecrets, error) {
+	salt := make([]byte, 16)
+	_, err := io.ReadFull(rand.Reader, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &MetadataSecrets{
+		Cipher:     secretsCipher,
+		KDF:        secretsKDF,
+		Iterations: secretsIterations,
+		Salt:       base64.StdEncoding.EncodeToString(salt),
+	}, nil
+}
+
+func encryptSecret(aead cipher.AEAD, secret string) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+func decryptSecret(aead cipher.AEAD, secret string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil || len(b) < aead.NonceSize() {
+		return "", fmt.Errorf("Malformed encrypted secret")
+	}
+	plain, err := aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("Secret decryption failed, wrong passphrase?")
+	}
+	return string(plain), nil
+}
+
+func backupTenant(cl string, tn string, aead cipher.AEAD) (BackupTenant, error) {
+	t := BackupTenant{Name: tn}
+
+	md, err := efsutil.GetMDPat(cl, tn, "", "", "")
+	if err != nil {
+		return t, fmt.Errorf("Tenant %s/%s: %v", cl, tn, err)
+	}
+	t.Metadata = md
+
+	buckets, err := efsutil.GetBuckets(cl, tn)
+	if err != nil {
+		return t, err
+	}
+	for _, bk := range buckets {
+		md, err := efsutil.GetMDPat(cl, tn, bk, "", "")
+		if err != nil {
+			return t, fmt.Errorf("Bucket %s/%s/%s: %v", cl, tn, bk, err)
+		}
+		// custom attributes like quotas are kept on the name hash id object
+		custom, err := efsutil.GetBucketCustomMD(cl, tn, bk)
+		if err != nil {
+			return t, fmt.Errorf("Bucket %s/%s/%s: %v", cl, tn, bk, err)
+		}
+		for k, v := range custom {
+			md[k] = v
+		}
+		t.Buckets = append(t.Buckets, BackupBucket{Name: bk, Metadata: md})
+	}
+
+	users, err := efsutil.GetUsers(cl, tn)
+	if err != nil {
+		return t, err
+	}
+	for _, u := range users {
+		if aead != nil {
+			u.Secret, err = encryptSecret(aead, u.Secret)
+			if err != nil {
+				return t, err
+			}
+		}
+		t.Users = append(t.Users, *u)
+	}
+	return t, nil
+}
+
+func NewMetadataBackup(encrypt bool, passphrase string) (*MetadataBackup, error) {
+	b := &MetadataBackup{
+		Format:  metadataFormat,
+		Version: metadataVersion,
+		Created: time.Now().Unix(),
+	}
+
+	var aead cipher.AEAD
+	if encrypt {
+		var err error
+		b.Secrets, err = newSecrets()
+		if err != nil {
+			return nil, err
+		}
+		aead, err = secretsAEAD(b.Secrets, passphrase)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	md, err := efsutil.GetMDPat("", "svcs", "", "", "X-")
+	if err != nil {
+		return nil, fmt.Errorf("Tenant svcs: %v", err)
+	}
+	b.System = md
+
+	clusters, err := efsutil.GetClusters()
+	if err != nil {
+		return nil, err
+	}
+	for _, cl := range clusters {
+		c := BackupCluster{Name: cl}
+		c.Metadata, err = efsutil.GetMDPat(cl, "", "", "", "")
+		if err != nil {
+			return nil, fmt.Errorf("Cluster %s: %v", cl, err)
+		}
+
+		tenants, err := efsutil.GetTenants(cl)
+		if err != nil {
+			return nil, err
+		}
+		for _, tn := range tenants {
+			t, err := backupTenant(cl, tn, aead)
+			if err != nil {
+				return nil, err
+			}
+			c.Tenants = append(c.Tenants, t)
+		}
+		b.Clusters = append(b.Clusters, c)
+	}
+
+	services, err := efsutil.GetServices()
+	if err != nil {
+		return nil, err
+	}
+	for _, svc := range services {
+		s := BackupService{Name: svc}
+		s.Metadata, err = efsutil.GetMDPat("", "svcs", svc, "", "")
+		if err != nil {
+			return nil, fmt.Errorf("Service %s: %v", svc, err)
+		}
+		s.Entries, err = efsutil.ListKeys("", "svcs", svc, "")
+		if err != nil {
+			return nil, err
+		}
+		b.Services = append(b.Services, s)
+	}
+
+	return b, nil
+}
+
+func BackupMetadata(fpath string, encrypt bool, passphraseFile string) error {
+	passphrase := ""
+	if encrypt {
+		var err error
+		passphrase, err = ReadPassphrase(passphraseFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	b, err := NewMetadataBackup(encrypt, passphrase)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(fpath, append(data, '\n'), 0600)
+	if err != nil {
+		return err
+	}
+
+	tenants, buckets, users := 0, 0, 0
+	for _, c := range b.Clusters {
+		tenants += len(c.Tenants)
+		for _, t := range c.Tenants {
+			buckets += len(t.Buckets)
+			users += len(t.Users)
+		}
+	}
+	fmt.Printf("Backed up %d cluster(s), %d tenant(s), %d bucket(s), %d user(s) and %d service(s) to %s\n",
+		len(b.Clusters), tenants, buckets, users, len(b.Services), fpath)
+	if !encrypt && users > 0 {
+		fmt.Println("Warning: user secrets are stored in clear, use --encrypt-secrets or keep the file safe")
+	}
+	return nil
+}
+
+var (
+	backupEncrypt        bool
+	backupPassphraseFile string
+
+	metadataBackupCmd = &cobra.Command{
+		Use:   "metadata-backup <file>",
+		Short: "back up namespaces, users and services metadata",
+		Long: `dump clusters, tenants and buckets with their attributes, users, services
+with their metadata and served entries into a versioned JSON document.
+Object data is not included. User secrets are encrypted with
+--encrypt-secrets, the passphrase is read from --passphrase-file or the
+` + passphraseEnv + ` environment variable`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := BackupMetadata(args[0], backupEncrypt, backupPassphraseFile)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	metadataBackupCmd.Flags().BoolVarP(&backupEncrypt, "encrypt-secrets", "e", false, "Encrypt user secrets with a passphrase")
+	metadataBackupCmd.Flags().StringVarP(&backupPassphraseFile, "passphrase-file", "p", "", "File holding the passphrase")
+	SystemCmd.AddCommand(metadataBackupCmd)
+}
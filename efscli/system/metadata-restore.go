@@ -0,0 +1,559 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package system
+
+/*
+#include "ccow.h"
+*/
+import "C"
+import "unsafe"
+
+import (
+	"crypto/cipher"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/sabbot/module/efscli/service"
+	"github.com/spf13/cobra"
+)
+
+// restoreAttrs are the system attributes a namespace is recreated with,
+// the ones InheritBucketAttributes sets
+var restoreAttrs = []string{
+	"ccow-chunkmap-chunk-size",
+	"ccow-chunkmap-btree-marker",
+	"ccow-replication-count",
+	"ccow-sync-put",
+	"ccow-number-of-versions",
+	"ccow-ec-data-mode",
+	"ccow-ec-trigger-policy",
+	"ccow-ec-enabled",
+	"ccow-hash-type",
+	"ccow-select-policy",
+}
+
+// restoredMetadata picks the restored system attributes and the custom X-
+// keys out of backed up metadata
+func restoredMetadata(md map[string]string) map[string]string {
+	res := make(map[string]string)
+	for _, k := range restoreAttrs {
+		if v, ok := md[k]; ok {
+			res[k] = v
+		}
+	}
+	for k, v := range md {
+		if strings.HasPrefix(k, "X-") {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// missingAttrs lists the restored system attributes the backup lacks
+func missingAttrs(md map[string]string) []string {
+	var res []string
+	for _, k := range restoreAttrs {
+		if _, ok := md[k]; !ok {
+			res = append(res, k)
+		}
+	}
+	return res
+}
+
+func customKeys(md map[string]string) []efsutil.KeyValue {
+	var res []efsutil.KeyValue
+	for k, v := range md {
+		if strings.HasPrefix(k, "X-") {
+			res = append(res, efsutil.KeyValue{Key: k, Value: v})
+		}
+	}
+	return res
+}
+
+// metadataConflicts lists restored keys whose live value differs
+func metadataConflicts(live map[string]string, backup map[string]string) []string {
+	var res []string
+	for k, v := range restoredMetadata(backup) {
+		if lv, ok := live[k]; !ok || lv != v {
+			if !ok {
+				lv = "-"
+			}
+			res = append(res, fmt.Sprintf("%s live %s, backup %s", k, lv, v))
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// createInherit creates a cluster, a tenant or a bucket, depending on which
+// of the names are given, with the system attributes of the backup
+func createInherit(cl string, tn string, bk string, md map[string]string) error {
+	conf, err := efsutil.GetLibccowConf()
+	if err != nil {
+		return err
+	}
+
+	c_conf := C.CString(string(conf))
+	defer C.free(unsafe.Pointer(c_conf))
+
+	c_cluster := C.CString(cl)
+	defer C.free(unsafe.Pointer(c_cluster))
+
+	c_tenant := C.CString(tn)
+	defer C.free(unsafe.Pointer(c_tenant))
+
+	c_bucket := C.CString(bk)
+	defer C.free(unsafe.Pointer(c_bucket))
+
+	var tc C.ccow_t
+	var ret C.int
+
+	switch {
+	case tn == "":
+		c_empty := C.CString("")
+		defer C.free(unsafe.Pointer(c_empty))
+		ret = C.ccow_admin_init(c_conf, c_empty, 1, &tc)
+	case bk == "":
+		ret = C.ccow_admin_init(c_conf, c_cluster, C.strlen(c_cluster)+1, &tc)
+	default:
+		ret = C.ccow_tenant_init(c_conf, c_cluster, C.strlen(c_cluster)+1,
+			c_tenant, C.strlen(c_tenant)+1, &tc)
+	}
+	if ret != 0 {
+		return fmt.Errorf("ccow_tenant_init err=%d", ret)
+	}
+	defer C.ccow_tenant_term(tc)
+
+	var c C.ccow_completion_t
+	ret = C.ccow_create_completion(tc, nil, nil, 1, &c)
+	if ret != 0 {
+		return fmt.Errorf("ccow_create_completion err=%d", ret)
+	}
+
+	// attributes are inherited only if all of them were backed up
+	if len(missingAttrs(md)) == 0 {
+		err = efsutil.InheritBucketAttributes(unsafe.Pointer(c), md)
+		if err != nil {
+			C.ccow_release(c)
+			return err
+		}
+	}
+
+	switch {
+	case tn == "":
+		ret = C.ccow_cluster_create(tc, c_cluster, C.strlen(c_cluster)+1, c)
+	case bk == "":
+		ret = C.ccow_tenant_create(tc, c_tenant, C.strlen(c_tenant)+1, c)
+	default:
+		ret = C.ccow_bucket_create(tc, c_bucket, C.strlen(c_bucket)+1, c)
+	}
+	if ret != 0 {
+		return fmt.Errorf("create err=%d", ret)
+	}
+
+	custom := customKeys(md)
+	if len(custom) == 0 {
+		return nil
+	}
+
+	obj := ""
+	if bk != "" {
+		obj, err = efsutil.GetMDKey(cl, tn, bk, "", "ccow-name-hash-id")
+		if err != nil {
+			return err
+		}
+	}
+	return efsutil.UpdateMDMany(cl, tn, bk, obj, custom)
+}
+
+type restorer struct {
+	dryRun    bool
+	aead      cipher.AEAD
+	created   int
+	unchanged int
+	conflicts int
+	warnings  int
+}
+
+func (r *restorer) report(status string, kind string, name string, details []string) {
+	switch status {
+	case "created":
+		r.created++
+		if r.dryRun {
+			status = "missing"
+		}
+	case "conflict":
+		r.conflicts++
+	default:
+		r.unchanged++
+		return
+	}
+	fmt.Printf("%-8s %-8s %s\n", status, kind, name)
+	for _, d := range details {
+		fmt.Printf("         %s\n", d)
+	}
+}
+
+// namespace restores a missing cluster, tenant or bucket, or compares an
+// existing one with the backup. It tells whether the namespace exists.
+func (r *restorer) namespace(kind string, exists bool, s []string, md map[string]string) (bool, error) {
+	name := strings.Join(s, "/")
+	for len(s) < 3 {
+		s = append(s, "")
+	}
+
+	if exists {
+		live, err := efsutil.GetMDPat(s[0], s[1], s[2], "", "")
+		if err != nil {
+			return true, fmt.Errorf("%s %s: %v", kind, name, err)
+		}
+		if s[2] != "" {
+			custom, err := efsutil.GetBucketCustomMD(s[0], s[1], s[2])
+			if err != nil {
+				return true, fmt.Errorf("%s %s: %v", kind, name, err)
+			}
+			for k, v := range custom {
+				live[k] = v
+			}
+		}
+		c := metadataConflicts(live, md)
+		if len(c) > 0 {
+			r.report("conflict", kind, name, c)
+		} else {
+			r.report("exists", kind, name, nil)
+		}
+		return true, nil
+	}
+
+	if !r.dryRun {
+		err := createInherit(s[0], s[1], s[2], md)
+		if err != nil {
+			return false, fmt.Errorf("%s %s: %v", kind, name, err)
+		}
+	}
+	var details []string
+	missing := missingAttrs(md)
+	if len(missing) > 0 {
+		r.warnings++
+		details = append(details, fmt.Sprintf("warning: backup lacks %s, system attributes left to defaults",
+			strings.Join(missing, ", ")))
+	}
+	r.report("created", kind, name, details)
+	return !r.dryRun, nil
+}
+
+func (r *restorer) users(cl string, tn string, users []efsutil.User, exists bool) error {
+	var live []*efsutil.User
+	if exists {
+		var err error
+		live, err = efsutil.GetUsers(cl, tn)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, u := range users {
+		name := cl + "/" + tn + "/" + u.Username
+		found := false
+		for _, lu := range live {
+			if lu.Username != u.Username {
+				continue
+			}
+			found = true
+			var c []string
+			if lu.Authkey != u.Authkey {
+				c = append(c, fmt.Sprintf("authkey live %s, backup %s", lu.Authkey, u.Authkey))
+			}
+			if lu.Hash != u.Hash {
+				c = append(c, "password differs")
+			}
+			if len(c) > 0 {
+				r.report("conflict", "user", name, c)
+			} else {
+				r.report("exists", "user", name, nil)
+			}
+		}
+		if found {
+			continue
+		}
+
+		if !r.dryRun {
+			user := u
+			if r.aead != nil {
+				var err error
+				user.Secret, err = decryptSecret(r.aead, u.Secret)
+				if err != nil {
+					return fmt.Errorf("user %s: %v", name, err)
+				}
+			}
+			err := efsutil.SaveUser(cl, tn, &user)
+			if err != nil {
+				return fmt.Errorf("user %s: %v", name, err)
+			}
+		}
+		r.report("created", "user", name, nil)
+	}
+	return nil
+}
+
+func (r *restorer) service(s BackupService, exists bool) error {
+	if !exists {
+		stype := s.Metadata["X-Service-Type"]
+		if !r.dryRun {
+			err := service.ServiceCreate(stype, s.Name)
+			if err != nil {
+				return fmt.Errorf("service %s: %v", s.Name, err)
+			}
+			err = efsutil.UpdateMDMany("", "svcs", s.Name, "", customKeys(s.Metadata))
+			if err != nil {
+				return fmt.Errorf("service %s: %v", s.Name, err)
+			}
+		}
+		r.report("created", "service", s.Name, nil)
+	} else {
+		live, err := efsutil.GetMDPat("", "svcs", s.Name, "", "X-")
+		if err != nil {
+			return fmt.Errorf("service %s: %v", s.Name, err)
+		}
+		c := metadataConflicts(live, customMetadataOnly(s.Metadata))
+		if len(c) > 0 {
+			r.report("conflict", "service", s.Name, c)
+		} else {
+			r.report("exists", "service", s.Name, nil)
+		}
+	}
+
+	var entries []string
+	if exists {
+		var err error
+		entries, err = efsutil.ListKeys("", "svcs", s.Name, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	stype := s.Metadata["X-Service-Type"]
+	for _, e := range s.Entries {
+		name := s.Name + " " + e
+		path := efsutil.ServiceObjectPath(stype, e)
+		status := "created"
+		var details []string
+		for _, le := range entries {
+			if le == e {
+				status = "exists"
+				break
+			}
+			if efsutil.ServiceObjectPath(stype, le) == path {
+				status = "conflict"
+				details = []string{"served as " + le}
+			}
+		}
+		if status == "created" && !r.dryRun {
+			err := efsutil.InsertServiceEntry(s.Name, e)
+			if err != nil {
+				return fmt.Errorf("service %s entry %s: %v", s.Name, e, err)
+			}
+		}
+		r.report(status, "entry", name, details)
+	}
+	return nil
+}
+
+func customMetadataOnly(md map[string]string) map[string]string {
+	res := make(map[string]string)
+	for k, v := range md {
+		if strings.HasPrefix(k, "X-") {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+func contains(list []string, name string) bool {
+	for _, n := range list {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *restorer) restore(b *MetadataBackup) error {
+	live, err := efsutil.GetMDPat("", "svcs", "", "", "X-")
+	if err != nil {
+		return fmt.Errorf("Tenant svcs: %v", err)
+	}
+	var missing []efsutil.KeyValue
+	for k, v := range b.System {
+		lv, ok := live[k]
+		if !ok {
+			missing = append(missing, efsutil.KeyValue{Key: k, Value: v})
+			r.report("created", "system", k, nil)
+		} else if lv != v {
+			r.report("conflict", "system", k, []string{"live and backup values differ"})
+		} else {
+			r.report("exists", "system", k, nil)
+		}
+	}
+	if len(missing) > 0 && !r.dryRun {
+		err = efsutil.UpdateMDMany("", "svcs", "", "", missing)
+		if err != nil {
+			return err
+		}
+	}
+
+	clusters, err := efsutil.GetClusters()
+	if err != nil {
+		return err
+	}
+	for _, c := range b.Clusters {
+		exists, err := r.namespace("cluster", contains(clusters, c.Name), []string{c.Name}, c.Metadata)
+		if err != nil {
+			return err
+		}
+
+		var tenants []string
+		if exists {
+			tenants, err = efsutil.GetTenants(c.Name)
+			if err != nil {
+				return err
+			}
+		}
+		for _, t := range c.Tenants {
+			texists, err := r.namespace("tenant", contains(tenants, t.Name), []string{c.Name, t.Name}, t.Metadata)
+			if err != nil {
+				return err
+			}
+
+			var buckets []string
+			if texists {
+				buckets, err = efsutil.GetBuckets(c.Name, t.Name)
+				if err != nil {
+					return err
+				}
+			}
+			for _, bk := range t.Buckets {
+				_, err = r.namespace("bucket", contains(buckets, bk.Name), []string{c.Name, t.Name, bk.Name}, bk.Metadata)
+				if err != nil {
+					return err
+				}
+			}
+
+			err = r.users(c.Name, t.Name, t.Users, texists)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	services, err := efsutil.GetServices()
+	if err != nil {
+		return err
+	}
+	for _, s := range b.Services {
+		err = r.service(s, contains(services, s.Name))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func RestoreMetadata(fpath string, dryRun bool, passphraseFile string) error {
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return err
+	}
+
+	var b MetadataBackup
+	err = json.Unmarshal(data, &b)
+	if err != nil {
+		return fmt.Errorf("Backup %s: %v", fpath, err)
+	}
+	if b.Format != metadataFormat {
+		return fmt.Errorf("Backup %s is not a metadata backup", fpath)
+	}
+	if b.Version > metadataVersion {
+		return fmt.Errorf("Backup %s version %d is newer than supported %d", fpath, b.Version, metadataVersion)
+	}
+
+	r := &restorer{dryRun: dryRun}
+	if b.Secrets != nil && !dryRun {
+		passphrase, err := ReadPassphrase(passphraseFile)
+		if err != nil {
+			return err
+		}
+		r.aead, err = secretsAEAD(b.Secrets, passphrase)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = r.restore(&b)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		fmt.Printf("Dry run: %d missing, %d unchanged, %d conflict(s), %d warning(s)\n",
+			r.created, r.unchanged, r.conflicts, r.warnings)
+	} else {
+		fmt.Printf("%d created, %d unchanged, %d conflict(s) skipped, %d warning(s)\n",
+			r.created, r.unchanged, r.conflicts, r.warnings)
+	}
+	return nil
+}
+
+var (
+	restoreDryRun         bool
+	restorePassphraseFile string
+
+	metadataRestoreCmd = &cobra.Command{
+		Use:   "metadata-restore <file>",
+		Short: "restore namespaces, users and services metadata",
+		Long: `recreate clusters, tenants, buckets, users, services and served entries
+missing from the system out of a metadata-backup document. Existing
+entries are left as they are and differences to the backup are reported
+as conflicts.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := RestoreMetadata(args[0], restoreDryRun, restorePassphraseFile)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	metadataRestoreCmd.Flags().BoolVarP(&restoreDryRun, "dry-run", "", false, "Report missing entries and conflicts without restoring")
+	metadataRestoreCmd.Flags().StringVarP(&restorePassphraseFile, "passphrase-file", "p", "", "File holding the passphrase of encrypted secrets")
+	SystemCmd.AddCommand(metadataRestoreCmd)
+}
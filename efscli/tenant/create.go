@@ -88,6 +88,7 @@ func TenantCreate(name string, flags []efsutil.FlagValue) error {
 
 var (
 	flags []efsutil.FlagValue
+	createProfile string
 	flagNames = []string {
 	 "replication-count",
 	 "number-of-versions",
@@ -105,6 +106,13 @@ var (
 		Long:  "create a new tenant namespace, defined as cluster/tenant",
 		Args:  validate.Tenant,
 		Run: func(cmd *cobra.Command, args []string) {
+			if createProfile != "" {
+				err := efsutil.ApplyProfile(cmd, flagNames, flags, createProfile)
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+			}
 			err := TenantCreate(args[0], flags)
 			if err != nil {
 				fmt.Println(err)
@@ -117,5 +125,6 @@ var (
 func init() {
 	flags = make([]efsutil.FlagValue, len(flagNames))
 	efsutil.ReadAttributes(createCmd, flagNames, flags)
+	createCmd.Flags().StringVarP(&createProfile, "profile", "P", "", "Attribute profile, explicit flags take precedence")
 	TenantCmd.AddCommand(createCmd)
 }
@@ -30,6 +30,7 @@ import "C"
 import "unsafe"
 
 import (
+	"github.com/sabbot/module/efscli/bucket"
 	"github.com/sabbot/module/efscli/efsutil"
 	"github.com/sabbot/module/efscli/validate"
 	"fmt"
@@ -71,14 +72,43 @@ func TenantDelete(name string) error {
 	return nil
 }
 
+// TenantDeleteRecursive unserves and deletes buckets, objects and users of
+// the tenant and then the tenant itself
+func TenantDeleteRecursive(name string, dryRun bool, jobs int) error {
+	t, err := bucket.NewTeardown(name)
+	if err != nil {
+		return err
+	}
+
+	if !t.Confirm(dryRun) {
+		return nil
+	}
+
+	err = t.Run(jobs)
+	if err != nil {
+		return err
+	}
+
+	return TenantDelete(name)
+}
+
 var (
+	deleteRecursive bool
+	deleteDryRun    bool
+	deleteJobs      int
+
 	deleteCmd = &cobra.Command{
 		Use:   "delete <cluster>/<tenant>",
 		Short: "delete an existing tenant namespace",
 		Long:  "delete an existing tenant namespace, defined as cluster/tenant",
 		Args:  validate.Tenant,
 		Run: func(cmd *cobra.Command, args []string) {
-			err := TenantDelete(args[0])
+			var err error
+			if deleteRecursive || deleteDryRun {
+				err = TenantDeleteRecursive(args[0], deleteDryRun, deleteJobs)
+			} else {
+				err = TenantDelete(args[0])
+			}
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
@@ -88,5 +118,8 @@ var (
 )
 
 func init() {
+	deleteCmd.Flags().BoolVarP(&deleteRecursive, "recursive", "r", false, "Unserve and delete all buckets, objects and users of the tenant first")
+	deleteCmd.Flags().BoolVarP(&deleteDryRun, "dry-run", "", false, "Only show what a recursive delete would remove")
+	deleteCmd.Flags().IntVarP(&deleteJobs, "jobs", "j", 16, "Number of parallel deletes")
 	TenantCmd.AddCommand(deleteCmd)
 }
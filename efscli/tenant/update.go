@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package tenant
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/sabbot/module/efscli/validate"
+	"github.com/spf13/cobra"
+)
+
+func TenantUpdate(name string, flags []efsutil.FlagValue) error {
+	e := validate.Flags(flags)
+	if e != nil {
+		return e
+	}
+
+	s := strings.Split(name, "/")
+
+	before, err := efsutil.GetMDPat(s[0], s[1], "", "", "")
+	if err != nil {
+		return fmt.Errorf("Tenant %s: %v", name, err)
+	}
+
+	newData := efsutil.NewDataOnlyAttributes(flags)
+	if len(newData) == 0 && !efsutil.HasCustomAttributes(flags) {
+		return fmt.Errorf("Nothing to update, no attributes specified")
+	}
+
+	if len(newData) > 0 {
+		err = efsutil.UpdateDefaultAttributes(s[0], s[1], "", "", flags)
+		if err != nil {
+			return err
+		}
+	}
+
+	if efsutil.HasCustomAttributes(flags) {
+		err = efsutil.ModifyCustomAttributes(s[0], s[1], "", "", flags)
+		if err != nil {
+			return err
+		}
+	}
+
+	after, err := efsutil.GetMDPat(s[0], s[1], "", "", "")
+	if err != nil {
+		return err
+	}
+
+	if efsutil.PrintMDDiff(before, after) == 0 {
+		fmt.Printf("Tenant %s is unchanged\n", name)
+	}
+
+	for _, name := range newData {
+		fmt.Printf("Warning: %s only applies to buckets and objects created after the update\n", name)
+	}
+	return nil
+}
+
+var (
+	updateFlags []efsutil.FlagValue
+
+	updateCmd = &cobra.Command{
+		Use:   "update <cluster>/<tenant>",
+		Short: "update tenant attributes",
+		Long:  "update attributes of an existing tenant and show the changes",
+		Args:  validate.Tenant,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := TenantUpdate(args[0], updateFlags)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	updateFlags = make([]efsutil.FlagValue, len(flagNames))
+	efsutil.ReadAttributes(updateCmd, flagNames, updateFlags)
+	TenantCmd.AddCommand(updateCmd)
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2015-2018 Nexenta Systems, Inc.
+ *
+ * This file is part of EdgeFS Project
+ * (see https://github.com/Nexenta/edgefs).
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package tenant
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sabbot/module/efscli/bucket"
+	"github.com/sabbot/module/efscli/efsutil"
+	"github.com/sabbot/module/efscli/validate"
+
+	"github.com/im-kulikov/sizefmt"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+func TenantUsage(name string, top int, threshold float64) error {
+	s := strings.Split(name, "/")
+
+	md, err := efsutil.GetMDPat(s[0], s[1], "", "", "")
+	if err != nil {
+		return fmt.Errorf("Tenant %s: %v", name, err)
+	}
+
+	buckets, err := efsutil.GetBuckets(s[0], s[1])
+	if err != nil {
+		return err
+	}
+
+	total := &bucket.Usage{Name: name}
+	total.Quotas(md)
+
+	var usages []*bucket.Usage
+	for _, bk := range buckets {
+		u, err := bucket.GetBucketUsage(s[0], s[1], bk)
+		if err != nil {
+			fmt.Printf("ERROR: %v\n", err)
+			continue
+		}
+		total.Add(u)
+		usages = append(usages, u)
+	}
+
+	all := usages
+
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].Bytes > usages[j].Bytes
+	})
+	if top > 0 && top < len(usages) {
+		usages = usages[:top:top]
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetBorder(false)
+	table.SetHeader([]string{"Bucket", "Bytes", "Objects", "Versions", "Snapviews", "Bytes %", "Count %"})
+	for _, u := range usages {
+		pb, pc := u.Percents()
+		table.Append([]string{u.Name, strings.Trim(sizefmt.ByteSize(float64(u.Bytes)), " "),
+			strconv.FormatUint(u.Objects, 10), strconv.FormatUint(u.Versions, 10),
+			strconv.FormatUint(u.Snapviews, 10), pb, pc})
+	}
+	table.Render()
+	fmt.Println()
+
+	fmt.Printf("Tenant %s, %d bucket(s):\n", name, len(buckets))
+	bucket.PrintUsage(total)
+
+	for _, u := range all {
+		bucket.UsageWarnings("bucket", u, threshold)
+	}
+	bucket.UsageWarnings("tenant", total, threshold)
+	return nil
+}
+
+var (
+	usageTop       int
+	usageThreshold float64
+
+	usageCmd = &cobra.Command{
+		Use:   "usage <cluster>/<tenant>",
+		Short: "show tenant usage versus quotas",
+		Long:  "roll up bucket usage of a tenant and compare it against bucket and tenant quotas",
+		Args:  validate.Tenant,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := TenantUsage(args[0], usageTop, usageThreshold)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	usageCmd.Flags().IntVarP(&usageTop, "top", "", 0, "Only list the N largest buckets")
+	usageCmd.Flags().Float64VarP(&usageThreshold, "threshold", "w", 80, "Warn when quota usage reaches the percentage")
+	TenantCmd.AddCommand(usageCmd)
+}
@@ -79,6 +79,10 @@ func ServiceCreate(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("Invalid service type specified: %s", stype)
 	}
 
+	if efsutil.IsServiceCompanion(name) {
+		return fmt.Errorf("Invalid service name specified: %s, .stat and .history suffixes are reserved", name)
+	}
+
 	r, _ := regexp.Compile("^[^/ ]+$")
 	if r.MatchString(name) {
 		return nil
@@ -265,3 +269,14 @@ func ServiceIscsiOpts(opath, opts string) error {
 	}
 	return nil
 }
+
+func ObjectOnDemandBulk(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Requires <cluster>/<tenant>/<bucket>[/<prefix>]")
+	}
+	r, _ := regexp.Compile("^[^/ ]+/[^/ ]+/[^/ ]+(/.*)?$")
+	if !r.MatchString(args[0]) {
+		return fmt.Errorf("Invalid bucket or prefix specified: %s ", args[0])
+	}
+	return nil
+}